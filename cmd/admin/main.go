@@ -0,0 +1,39 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	_ "github.com/lib/pq"
+	"github.com/technopark_database/configs"
+	authRepository "github.com/technopark_database/internal/auth/repository"
+	authUseCase "github.com/technopark_database/internal/auth/usecases"
+	"github.com/technopark_database/internal/consts"
+
+	"log"
+)
+
+// Appoints the first admin, the api lets only admins grant the role.
+func main() {
+	nickname := flag.String("nickname", "", "user to make an admin")
+	flag.Parse()
+	if *nickname == "" {
+		flag.Usage()
+		log.Fatal("nickname is required")
+	}
+
+	db, err := sql.Open("postgres", configs.GetConnectionString())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+
+	authRepo := authRepository.NewAuthPgRepository(db)
+	authUseCase := authUseCase.NewAuthUseCase(authRepo, true)
+
+	if customErr := authUseCase.GrantRole(*nickname, consts.RoleAdmin, ""); customErr != nil {
+		log.Fatal(customErr.UserMessage)
+	}
+	log.Printf("%s is an admin now", *nickname)
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"database/sql"
-	"fmt"
 	"github.com/labstack/echo/v4"
 	_ "github.com/lib/pq"
+	"github.com/technopark_database/configs"
+	authDelivery "github.com/technopark_database/internal/auth/delivery"
+	authRepository "github.com/technopark_database/internal/auth/repository"
+	authUseCase "github.com/technopark_database/internal/auth/usecases"
+
 	userDelivery "github.com/technopark_database/internal/user/delivery"
 	userRepository "github.com/technopark_database/internal/user/repository"
 	userUseCase "github.com/technopark_database/internal/user/usecases"
@@ -29,17 +33,19 @@ import (
 	threadUseCase "github.com/technopark_database/internal/thread/usecases"
 
 	"log"
+	"os"
 )
 
-func GetConnectionString() string {
-	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		"localhost", 5432, "docker", "docker", "docker")
+// AUTH_MODE=strict makes write endpoints require a token,
+// any other value keeps them open for the functional tests
+func IsAuthOpen() bool {
+	return os.Getenv("AUTH_MODE") != "strict"
 }
 
 func main() {
 	e := echo.New()
 
-	db, err := sql.Open("postgres", GetConnectionString())
+	db, err := sql.Open("postgres", configs.GetConnectionString())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -47,14 +53,19 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Auth
+	authRepo := authRepository.NewAuthPgRepository(db)
+	authUseCase := authUseCase.NewAuthUseCase(authRepo, IsAuthOpen())
+	authHandler := authDelivery.NewAuthHandler(authUseCase)
+
 	// User
 	userRepo := userRepository.NewUserPgRepository(db)
-	userUseCase := userUseCase.NewUserUseCase(userRepo)
+	userUseCase := userUseCase.NewUserUseCase(userRepo, authUseCase)
 	userHandler := userDelivery.NewUserHandler(userUseCase)
 
 	// Forum
 	forumRepo := forumRepository.NewForumPgRepository(db)
-	forumUseCase := forumUseCase.NewForumUseCase(forumRepo, userUseCase)
+	forumUseCase := forumUseCase.NewForumUseCase(forumRepo, userUseCase, authUseCase)
 	forumHandler := forumDelivery.NewForumHandler(forumUseCase)
 
 	// Vote
@@ -63,18 +74,21 @@ func main() {
 
 	// Thread
 	threadRepo := threadRepository.NewThreadPgRepository(db)
-	threadUseCase := threadUseCase.NewThreadUseCase(threadRepo, userUseCase, forumUseCase, voteUseCase)
+	threadUseCase := threadUseCase.NewThreadUseCase(threadRepo, userUseCase, forumUseCase, voteUseCase, authUseCase)
 	threadHandler := threadDelivery.NewThreadHandler(threadUseCase)
 
 	// Service
 	serviceRepo := serviceRepository.NewServicePgRepository(db)
-	serviceUseCase := serviceUseCase.NewServiceUseCase(serviceRepo)
+	serviceUseCase := serviceUseCase.NewServiceUseCase(serviceRepo, authUseCase)
 	serviceHandler := serviceDelivery.NewServiceHandler(serviceUseCase)
 
 	postRepo := postRepository.NewPostPgRepository(db)
-	postUseCase := postUseCase.NewPostUseCase(threadUseCase, postRepo, forumUseCase, userUseCase)
+	postUseCase := postUseCase.NewPostUseCase(threadUseCase, postRepo, forumUseCase, userUseCase, authUseCase)
 	postHandler := postDelivery.NewPostHandler(postUseCase)
 
+	e.Use(authHandler.Middleware())
+
+	authHandler.Configure(e)
 	userHandler.Configure(e)
 	forumHandler.Configure(e)
 	serviceHandler.Configure(e)
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	_ "github.com/lib/pq"
+	"github.com/technopark_database/configs"
+	authRepository "github.com/technopark_database/internal/auth/repository"
+	authUseCase "github.com/technopark_database/internal/auth/usecases"
+
+	userRepository "github.com/technopark_database/internal/user/repository"
+	userUseCase "github.com/technopark_database/internal/user/usecases"
+
+	voteRepository "github.com/technopark_database/internal/vote/repository"
+	voteUseCase "github.com/technopark_database/internal/vote/usecases"
+
+	forumRepository "github.com/technopark_database/internal/forum/repository"
+	forumUseCase "github.com/technopark_database/internal/forum/usecases"
+
+	threadRepository "github.com/technopark_database/internal/thread/repository"
+	threadUseCase "github.com/technopark_database/internal/thread/usecases"
+
+	"log"
+	"time"
+)
+
+// Removes threads that stayed soft deleted longer than -retention
+// together with their posts and votes, meant to be run periodically.
+func main() {
+	retention := flag.Duration("retention", 30*24*time.Hour, "how long deleted threads stay restorable")
+	flag.Parse()
+
+	db, err := sql.Open("postgres", configs.GetConnectionString())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+
+	// the job runs next to the database, so auth checks are open
+	authRepo := authRepository.NewAuthPgRepository(db)
+	authUseCase := authUseCase.NewAuthUseCase(authRepo, true)
+
+	userRepo := userRepository.NewUserPgRepository(db)
+	userUseCase := userUseCase.NewUserUseCase(userRepo, authUseCase)
+
+	forumRepo := forumRepository.NewForumPgRepository(db)
+	forumUseCase := forumUseCase.NewForumUseCase(forumRepo, userUseCase, authUseCase)
+
+	voteRepo := voteRepository.NewVoteRepository(db)
+	voteUseCase := voteUseCase.NewVoteUseCase(voteRepo)
+
+	threadRepo := threadRepository.NewThreadPgRepository(db)
+	threadUseCase := threadUseCase.NewThreadUseCase(threadRepo, userUseCase, forumUseCase, voteUseCase, authUseCase)
+
+	purged, customErr := threadUseCase.Purge(*retention)
+	if customErr != nil {
+		log.Fatal(customErr.DebugMessage)
+	}
+	log.Printf("purged %d threads deleted more than %s ago", purged, *retention)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	_ "github.com/lib/pq"
+	"github.com/technopark_database/configs"
+	authRepository "github.com/technopark_database/internal/auth/repository"
+	authUseCase "github.com/technopark_database/internal/auth/usecases"
+
+	serviceRepository "github.com/technopark_database/internal/service/repository"
+	serviceUseCase "github.com/technopark_database/internal/service/usecases"
+
+	"log"
+	"os"
+)
+
+// Recomputes forum and thread counters from the source rows and prints
+// the drift as JSON, -fix overwrites the drifted counters.
+// Exits with status 2 when drift is found and left unfixed.
+func main() {
+	fix := flag.Bool("fix", false, "overwrite drifted counters")
+	flag.Parse()
+
+	db, err := sql.Open("postgres", configs.GetConnectionString())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+
+	// the command runs next to the database, so auth checks are open
+	authRepo := authRepository.NewAuthPgRepository(db)
+	authUseCase := authUseCase.NewAuthUseCase(authRepo, true)
+
+	serviceRepo := serviceRepository.NewServicePgRepository(db)
+	serviceUseCase := serviceUseCase.NewServiceUseCase(serviceRepo, authUseCase)
+
+	reconciliation, customErr := serviceUseCase.Reconcile(*fix, nil)
+	if customErr != nil {
+		log.Fatal(customErr.DebugMessage)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(reconciliation); err != nil {
+		log.Fatal(err)
+	}
+
+	hasDrift := len(reconciliation.Forums) != 0 || len(reconciliation.Threads) != 0
+	if hasDrift && !reconciliation.Fixed {
+		os.Exit(2)
+	}
+}
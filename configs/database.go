@@ -0,0 +1,9 @@
+package configs
+
+import "fmt"
+
+// shared by the server and the maintenance commands
+func GetConnectionString() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		"localhost", 5432, "docker", "docker", "docker")
+}
@@ -10,14 +10,14 @@ require (
 	github.com/go-playground/validator/v10 v10.4.1
 	github.com/labstack/echo v3.3.10+incompatible
 	github.com/labstack/echo/v4 v4.1.17
-	github.com/lib/pq v1.8.0 // indirect
+	github.com/lib/pq v1.8.0
 	github.com/mailcourses/technopark-dbms-forum v0.2.2 // indirect
 	github.com/mattn/go-colorable v0.1.8 // indirect
 	github.com/mkideal/cli v0.2.3 // indirect
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7 // indirect
 	github.com/sirupsen/logrus v1.7.0
 	github.com/tinylib/msgp v1.1.5 // indirect
-	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad // indirect
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	golang.org/x/net v0.0.0-20201224014010-6772e930b67b // indirect
 	golang.org/x/sys v0.0.0-20210105210732-16f7687f5001 // indirect
 	golang.org/x/term v0.0.0-20201210144234-2321bbc49cbf // indirect
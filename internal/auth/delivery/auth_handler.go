@@ -0,0 +1,157 @@
+package delivery
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/technopark_database/internal/auth"
+	"github.com/technopark_database/internal/helpers/caller"
+	reader "github.com/technopark_database/tools/requestReader"
+	"net/http"
+	"strings"
+)
+
+type AuthHandler struct {
+	authUseCase auth.AuthUseCase
+}
+
+func NewAuthHandler(authUseCase auth.AuthUseCase) *AuthHandler {
+	return &AuthHandler{authUseCase: authUseCase}
+}
+
+func (ah *AuthHandler) Configure(e *echo.Echo) {
+	e.POST("/api/session", ah.LoginHandler())
+	e.DELETE("/api/session", ah.LogoutHandler())
+	e.POST("/api/user/:nickname/password", ah.SetPasswordHandler())
+	e.POST("/api/user/:nickname/token", ah.CreateTokenHandler())
+	e.POST("/api/user/:nickname/admin", ah.GrantAdminHandler())
+	e.DELETE("/api/user/:nickname/admin", ah.RevokeAdminHandler())
+}
+
+type Message struct {
+	Message string   `json:"message"`
+	Fields  []string `json:"fields,omitempty"`
+}
+
+func getToken(cntx echo.Context) string {
+	header := cntx.Request().Header.Get(echo.HeaderAuthorization)
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+// Middleware resolves the caller from the Authorization header,
+// anonymous requests are passed through and checked by usecases
+func (ah *AuthHandler) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(cntx echo.Context) error {
+			token := getToken(cntx)
+			if token == "" {
+				return next(cntx)
+			}
+
+			user, err := ah.authUseCase.Authenticate(token)
+			if err != nil {
+				//logrus.Info(err.DebugMessage)
+				return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+			}
+			caller.Set(cntx, user)
+
+			return next(cntx)
+		}
+	}
+}
+
+func (ah *AuthHandler) LoginHandler() echo.HandlerFunc {
+	type Request struct {
+		Nickname string `json:"nickname" validate:"required"`
+		Password string `json:"password" validate:"required"`
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		session, err := ah.authUseCase.Login(req.Nickname, req.Password)
+		if err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusCreated, session)
+	}
+}
+
+func (ah *AuthHandler) LogoutHandler() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		if err := ah.authUseCase.Logout(getToken(cntx)); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, "")
+	}
+}
+
+func (ah *AuthHandler) SetPasswordHandler() echo.HandlerFunc {
+	type Request struct {
+		Password string `json:"password" validate:"required"`
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		nickname := cntx.Param("nickname")
+
+		err := ah.authUseCase.SetPassword(nickname, req.Password, caller.Get(cntx))
+		if err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, "")
+	}
+}
+
+func (ah *AuthHandler) CreateTokenHandler() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		nickname := cntx.Param("nickname")
+
+		session, err := ah.authUseCase.CreateToken(nickname, caller.Get(cntx))
+		if err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusCreated, session)
+	}
+}
+
+func (ah *AuthHandler) GrantAdminHandler() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		nickname := cntx.Param("nickname")
+
+		if err := ah.authUseCase.GrantAdmin(nickname, caller.Get(cntx)); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, "")
+	}
+}
+
+func (ah *AuthHandler) RevokeAdminHandler() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		nickname := cntx.Param("nickname")
+
+		if err := ah.authUseCase.RevokeAdmin(nickname, caller.Get(cntx)); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, "")
+	}
+}
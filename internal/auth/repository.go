@@ -0,0 +1,16 @@
+package auth
+
+import "github.com/technopark_database/internal/models"
+
+type AuthRepository interface {
+	UpsertPassword(nickname string, hash string) error
+	SelectPassword(nickname string) (*models.User, string, error)
+	InsertSession(session *models.Session, tokenHash string) error
+	SelectSessionUser(tokenHash string) (*models.User, error)
+	DeleteSession(tokenHash string) error
+	InsertRole(nickname string, role string, forum string) error
+	DeleteRole(nickname string, role string, forum string) error
+	IsAdmin(userID uint64) (bool, error)
+	IsModerator(userID uint64, forum string) (bool, error)
+	SelectModerators(forum string) ([]*models.User, error)
+}
@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/sirupsen/logrus"
+	"github.com/technopark_database/internal/auth"
+	"github.com/technopark_database/internal/models"
+)
+
+type AuthPgRepository struct {
+	db *sql.DB
+}
+
+func NewAuthPgRepository(db *sql.DB) auth.AuthRepository {
+	return &AuthPgRepository{db: db}
+}
+
+func (rep *AuthPgRepository) UpsertPassword(nickname string, hash string) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO credentials(user_id, password)
+		SELECT id, $2
+		FROM users
+		WHERE nickname = $1
+		ON CONFLICT (user_id) DO UPDATE
+		SET password = excluded.password`, nickname, hash)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return sql.ErrNoRows
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rep *AuthPgRepository) SelectPassword(nickname string) (*models.User, string, error) {
+	user := &models.User{}
+	var hash string
+	err := rep.db.QueryRow(`
+		SELECT u.id, u.nickname, u.fullname, u.about, u.email, c.password
+		FROM users u
+		JOIN credentials c on c.user_id = u.id
+		WHERE u.nickname = $1`, nickname).Scan(
+		&user.ID, &user.Nickname, &user.Fullname,
+		&user.About, &user.Email, &hash)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, hash, nil
+}
+
+func (rep *AuthPgRepository) InsertSession(session *models.Session, tokenHash string) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO sessions(token, user_id, expires)
+		VALUES ($1, $2, $3)`, tokenHash, session.UserID, session.Expires)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rep *AuthPgRepository) SelectSessionUser(tokenHash string) (*models.User, error) {
+	user := &models.User{}
+	err := rep.db.QueryRow(`
+		SELECT u.id, u.nickname, u.fullname, u.about, u.email
+		FROM sessions s
+		JOIN users u on u.id = s.user_id
+		WHERE s.token = $1
+		  AND (s.expires IS NULL OR s.expires > now())`, tokenHash).Scan(
+		&user.ID, &user.Nickname, &user.Fullname,
+		&user.About, &user.Email)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (rep *AuthPgRepository) DeleteSession(tokenHash string) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM sessions
+		WHERE token = $1`, tokenHash)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// forum is empty for global roles
+func (rep *AuthPgRepository) InsertRole(nickname string, role string, forum string) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO roles(user_id, role, forum)
+		SELECT id, $2, nullif($3, '')
+		FROM users
+		WHERE nickname = $1
+		ON CONFLICT DO NOTHING`, nickname, role, forum)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+
+	// nothing is inserted either for missing user or for already granted role
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		var exists bool
+		err := tx.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM users WHERE nickname = $1)`,
+			nickname).Scan(&exists)
+		if err == nil && !exists {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				logrus.Error(err)
+			}
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rep *AuthPgRepository) DeleteRole(nickname string, role string, forum string) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM roles
+		WHERE user_id = (SELECT id FROM users WHERE nickname = $1)
+		  AND role = $2
+		  AND coalesce(forum, '') = $3`, nickname, role, forum)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rep *AuthPgRepository) IsAdmin(userID uint64) (bool, error) {
+	var isAdmin bool
+	err := rep.db.QueryRow(`
+		SELECT EXISTS(SELECT 1
+		              FROM roles
+		              WHERE user_id = $1
+		                AND role = 'admin')`, userID).Scan(&isAdmin)
+	if err != nil {
+		return false, err
+	}
+	return isAdmin, nil
+}
+
+// forum owners and admins moderate the forum as well
+func (rep *AuthPgRepository) IsModerator(userID uint64, forum string) (bool, error) {
+	var isModerator bool
+	err := rep.db.QueryRow(`
+		SELECT EXISTS(SELECT 1
+		              FROM roles
+		              WHERE user_id = $1
+		                AND (role = 'admin' OR (role = 'moderator' AND forum = $2)))
+		    OR EXISTS(SELECT 1
+		              FROM forums f
+		              JOIN users u on u.nickname = f.profile
+		              WHERE u.id = $1
+		                AND f.slug = $2)`, userID, forum).Scan(&isModerator)
+	if err != nil {
+		return false, err
+	}
+	return isModerator, nil
+}
+
+func (rep *AuthPgRepository) SelectModerators(forum string) ([]*models.User, error) {
+	rows, err := rep.db.Query(`
+		SELECT u.id, u.nickname, u.fullname, u.about, u.email
+		FROM roles r
+		JOIN users u on u.id = r.user_id
+		WHERE r.forum = $1
+		  AND r.role = 'moderator'
+		ORDER BY u.nickname`, forum)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		err := rows.Scan(&user.ID, &user.Nickname,
+			&user.Fullname, &user.About, &user.Email)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"github.com/technopark_database/internal/helpers/errors"
+	"github.com/technopark_database/internal/models"
+)
+
+type AuthUseCase interface {
+	IsOpen() bool
+	SetPassword(nickname string, password string, caller *models.User) *errors.Error
+	HashPassword(password string) (string, *errors.Error)
+	Login(nickname string, password string) (*models.Session, *errors.Error)
+	CreateToken(nickname string, caller *models.User) (*models.Session, *errors.Error)
+	Logout(token string) *errors.Error
+	Authenticate(token string) (*models.User, *errors.Error)
+	CheckActor(caller *models.User, nickname string) *errors.Error
+	CheckOwner(caller *models.User, owner string) *errors.Error
+	CheckAdmin(caller *models.User) *errors.Error
+	CheckModerator(caller *models.User, forum string) *errors.Error
+	CheckEditor(caller *models.User, author string, forum string) *errors.Error
+	GrantRole(nickname string, role string, forum string) *errors.Error
+	RevokeRole(nickname string, role string, forum string) *errors.Error
+	GetModerators(forum string) ([]*models.User, *errors.Error)
+	GrantAdmin(nickname string, caller *models.User) *errors.Error
+	RevokeAdmin(nickname string, caller *models.User) *errors.Error
+}
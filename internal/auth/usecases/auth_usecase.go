@@ -0,0 +1,262 @@
+package usecases
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"github.com/technopark_database/internal/auth"
+	"github.com/technopark_database/internal/consts"
+	"github.com/technopark_database/internal/helpers/errors"
+	"github.com/technopark_database/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"time"
+)
+
+const sessionLifetime = 24 * time.Hour
+
+type AuthUseCase struct {
+	rep  auth.AuthRepository
+	open bool
+}
+
+// in open mode every request may act on behalf of any user,
+// which is what the functional test suite expects
+func NewAuthUseCase(rep auth.AuthRepository, open bool) auth.AuthUseCase {
+	return &AuthUseCase{rep: rep, open: open}
+}
+
+func (uc *AuthUseCase) IsOpen() bool {
+	return uc.open
+}
+
+// credentials outlive the open mode, so only the user itself
+// can set them whatever the mode is
+func (uc *AuthUseCase) SetPassword(nickname string, password string, caller *models.User) *errors.Error {
+	if caller == nil {
+		return errors.Get(consts.CodeUnauthorized)
+	}
+	if !strings.EqualFold(caller.Nickname, nickname) {
+		return errors.Get(consts.CodeForbidden)
+	}
+	hash, customErr := uc.HashPassword(password)
+	if customErr != nil {
+		return customErr
+	}
+
+	err := uc.rep.UpsertPassword(nickname, hash)
+	if err == sql.ErrNoRows {
+		return errors.Get(consts.CodeUserDoesNotExist)
+	} else if err != nil {
+		return errors.New(consts.CodeInternalServerError, err)
+	}
+	return nil
+}
+
+func (uc *AuthUseCase) HashPassword(password string) (string, *errors.Error) {
+	if password == "" {
+		return "", errors.Get(consts.CodeBadRequest)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", errors.New(consts.CodeInternalServerError, err)
+	}
+	return string(hash), nil
+}
+
+func (uc *AuthUseCase) Login(nickname string, password string) (*models.Session, *errors.Error) {
+	user, hash, err := uc.rep.SelectPassword(nickname)
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodeWrongCredentials)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return nil, errors.Get(consts.CodeWrongCredentials)
+	}
+
+	expires := time.Now().Add(sessionLifetime)
+	return uc.createSession(user, &expires)
+}
+
+// api tokens are sessions which never expire,
+// only an authenticated user can issue them for itself
+func (uc *AuthUseCase) CreateToken(nickname string, caller *models.User) (*models.Session, *errors.Error) {
+	if caller == nil {
+		return nil, errors.Get(consts.CodeUnauthorized)
+	}
+	if !strings.EqualFold(caller.Nickname, nickname) {
+		return nil, errors.Get(consts.CodeForbidden)
+	}
+
+	return uc.createSession(caller, nil)
+}
+
+func (uc *AuthUseCase) createSession(user *models.User, expires *time.Time) (*models.Session, *errors.Error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+
+	session := &models.Session{
+		Token:    hex.EncodeToString(tokenBytes),
+		UserID:   user.ID,
+		Nickname: user.Nickname,
+		Expires:  expires,
+	}
+	if err := uc.rep.InsertSession(session, hashToken(session.Token)); err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return session, nil
+}
+
+func (uc *AuthUseCase) Logout(token string) *errors.Error {
+	if token == "" {
+		return errors.Get(consts.CodeUnauthorized)
+	}
+
+	if err := uc.rep.DeleteSession(hashToken(token)); err != nil {
+		return errors.New(consts.CodeInternalServerError, err)
+	}
+	return nil
+}
+
+func (uc *AuthUseCase) Authenticate(token string) (*models.User, *errors.Error) {
+	user, err := uc.rep.SelectSessionUser(hashToken(token))
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodeUnauthorized)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return user, nil
+}
+
+// checks that caller may act as the user with this nickname
+func (uc *AuthUseCase) CheckActor(caller *models.User, nickname string) *errors.Error {
+	if uc.open {
+		return nil
+	}
+	if caller == nil {
+		return errors.Get(consts.CodeUnauthorized)
+	}
+	if !strings.EqualFold(caller.Nickname, nickname) {
+		return errors.Get(consts.CodeForbidden)
+	}
+	return nil
+}
+
+// only hashes of tokens are stored in the database
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// checks that caller is the owner itself or an admin
+func (uc *AuthUseCase) CheckOwner(caller *models.User, owner string) *errors.Error {
+	if uc.open {
+		return nil
+	}
+	if caller == nil {
+		return errors.Get(consts.CodeUnauthorized)
+	}
+	if strings.EqualFold(caller.Nickname, owner) {
+		return nil
+	}
+	return uc.CheckAdmin(caller)
+}
+
+func (uc *AuthUseCase) CheckAdmin(caller *models.User) *errors.Error {
+	if uc.open {
+		return nil
+	}
+	return uc.checkAdmin(caller)
+}
+
+func (uc *AuthUseCase) checkAdmin(caller *models.User) *errors.Error {
+	if caller == nil {
+		return errors.Get(consts.CodeUnauthorized)
+	}
+
+	isAdmin, err := uc.rep.IsAdmin(caller.ID)
+	if err != nil {
+		return errors.New(consts.CodeInternalServerError, err)
+	}
+	if !isAdmin {
+		return errors.Get(consts.CodeForbidden)
+	}
+	return nil
+}
+
+// forum owner, moderators of the forum and admins pass the check
+func (uc *AuthUseCase) CheckModerator(caller *models.User, forum string) *errors.Error {
+	if uc.open {
+		return nil
+	}
+	if caller == nil {
+		return errors.Get(consts.CodeUnauthorized)
+	}
+
+	isModerator, err := uc.rep.IsModerator(caller.ID, forum)
+	if err != nil {
+		return errors.New(consts.CodeInternalServerError, err)
+	}
+	if !isModerator {
+		return errors.Get(consts.CodeForbidden)
+	}
+	return nil
+}
+
+// content can be edited by its author or by moderators of its forum
+func (uc *AuthUseCase) CheckEditor(caller *models.User, author string, forum string) *errors.Error {
+	if uc.open {
+		return nil
+	}
+	if caller != nil && strings.EqualFold(caller.Nickname, author) {
+		return nil
+	}
+	return uc.CheckModerator(caller, forum)
+}
+
+func (uc *AuthUseCase) GrantRole(nickname string, role string, forum string) *errors.Error {
+	err := uc.rep.InsertRole(nickname, role, forum)
+	if err == sql.ErrNoRows {
+		return errors.Get(consts.CodeUserDoesNotExist)
+	} else if err != nil {
+		return errors.New(consts.CodeInternalServerError, err)
+	}
+	return nil
+}
+
+func (uc *AuthUseCase) RevokeRole(nickname string, role string, forum string) *errors.Error {
+	if err := uc.rep.DeleteRole(nickname, role, forum); err != nil {
+		return errors.New(consts.CodeInternalServerError, err)
+	}
+	return nil
+}
+
+func (uc *AuthUseCase) GetModerators(forum string) ([]*models.User, *errors.Error) {
+	users, err := uc.rep.SelectModerators(forum)
+	if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return users, nil
+}
+
+// roles outlive the open mode, so only admins can manage admins
+// whatever the mode is, the first admin is appointed by cmd/admin
+func (uc *AuthUseCase) GrantAdmin(nickname string, caller *models.User) *errors.Error {
+	if customErr := uc.checkAdmin(caller); customErr != nil {
+		return customErr
+	}
+	return uc.GrantRole(nickname, consts.RoleAdmin, "")
+}
+
+func (uc *AuthUseCase) RevokeAdmin(nickname string, caller *models.User) *errors.Error {
+	if customErr := uc.checkAdmin(caller); customErr != nil {
+		return customErr
+	}
+	return uc.RevokeRole(nickname, consts.RoleAdmin, "")
+}
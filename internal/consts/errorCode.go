@@ -17,4 +17,12 @@ const (
 	CodeVoteAlreadyExist
 	CodeVoteDoesNotExist
 	CodeParentPostDoesNotExistInThread
+	CodeUnauthorized
+	CodeForbidden
+	CodeWrongCredentials
+	CodeUserBanned
+	CodeForumArchived
+	CodeForumMembersOnly
+	CodeArchiveConflict
+	CodeThreadLocked
 )
@@ -0,0 +1,39 @@
+package consts
+
+// archived forums are kept read-only, deleted ones are removed with all their content
+const (
+	ForumRemovalArchive = "archive"
+	ForumRemovalDelete  = "delete"
+)
+
+// forum directory sort keys
+const (
+	ForumSortSlug    = "slug"
+	ForumSortCreated = "created"
+	ForumSortPosts   = "posts"
+	ForumSortThreads = "threads"
+)
+
+// forum activity buckets, hours are stored and the rest is summed up
+const (
+	ActivityBucketHour = "hour"
+	ActivityBucketDay  = "day"
+	ActivityBucketWeek = "week"
+)
+
+// forum visibility, content of non-public forums is shown to members only
+const (
+	ForumPublic  = "public"
+	ForumPrivate = "private"
+	ForumHidden  = "hidden"
+)
+
+// forum archive record types in replay order
+const (
+	ArchiveUser   = "user"
+	ArchiveForum  = "forum"
+	ArchiveThread = "thread"
+	ArchivePost   = "post"
+	ArchiveVote   = "vote"
+	ArchiveEnd    = "end"
+)
@@ -0,0 +1,7 @@
+package consts
+
+// users without a role are plain members
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
@@ -0,0 +1,9 @@
+package consts
+
+// reserved account which takes over threads, posts
+// and forums of deleted users
+const (
+	DeletedUserNickname = "deleted"
+	DeletedUserFullname = "Deleted user"
+	DeletedUserEmail    = "deleted@localhost"
+)
@@ -0,0 +1,23 @@
+package forum
+
+import (
+	"errors"
+	"github.com/technopark_database/internal/models"
+)
+
+var (
+	ErrMalformedArchive = errors.New("malformed forum archive")
+	ErrArchiveConflict  = errors.New("forum archive conflicts with existing data")
+)
+
+// ArchiveWriter receives exported records in replay order:
+// users, the forum, threads, posts, votes and the end marker
+type ArchiveWriter interface {
+	Write(record *models.ArchiveRecord) error
+}
+
+// ArchiveReader yields archive records one by one,
+// io.EOF is returned when the input is over
+type ArchiveReader interface {
+	Read() (*models.ArchiveRecord, error)
+}
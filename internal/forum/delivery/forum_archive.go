@@ -0,0 +1,53 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/technopark_database/internal/forum"
+	"github.com/technopark_database/internal/models"
+	"io"
+	"net/http"
+)
+
+// streams one JSON encoded record per line, the status line is sent
+// with the first record so that earlier errors can still be reported
+type ndjsonArchiveWriter struct {
+	response *echo.Response
+	encoder  *json.Encoder
+}
+
+func newNDJSONArchiveWriter(response *echo.Response) *ndjsonArchiveWriter {
+	return &ndjsonArchiveWriter{response: response, encoder: json.NewEncoder(response)}
+}
+
+func (w *ndjsonArchiveWriter) Write(record *models.ArchiveRecord) error {
+	if !w.response.Committed {
+		w.response.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+		w.response.WriteHeader(http.StatusOK)
+	}
+	if err := w.encoder.Encode(record); err != nil {
+		return err
+	}
+	w.response.Flush()
+	return nil
+}
+
+// reads one JSON encoded record per line
+type ndjsonArchiveReader struct {
+	decoder *json.Decoder
+}
+
+func newNDJSONArchiveReader(body io.Reader) *ndjsonArchiveReader {
+	return &ndjsonArchiveReader{decoder: json.NewDecoder(body)}
+}
+
+func (r *ndjsonArchiveReader) Read() (*models.ArchiveRecord, error) {
+	record := &models.ArchiveRecord{}
+	if err := r.decoder.Decode(record); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", forum.ErrMalformedArchive, err)
+	}
+	return record, nil
+}
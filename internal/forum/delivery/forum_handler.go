@@ -5,10 +5,12 @@ import (
 	//"github.com/sirupsen/logrus"
 	"github.com/technopark_database/internal/consts"
 	"github.com/technopark_database/internal/forum"
+	"github.com/technopark_database/internal/helpers/caller"
 	"github.com/technopark_database/internal/helpers/errors"
 	"github.com/technopark_database/internal/models"
 	reader "github.com/technopark_database/tools/requestReader"
 	"net/http"
+	"time"
 )
 
 type ForumHandler struct {
@@ -20,36 +22,58 @@ func NewForumHandler(usecase forum.ForumUseCase) *ForumHandler {
 }
 
 func (fh *ForumHandler) Configure(e *echo.Echo) {
+	e.GET("/api/forums", fh.GetForums())
 	e.POST("/api/forum/create", fh.CreateHandler())
+	e.POST("/api/forum/import", fh.ImportHandler())
 	e.GET("/api/forum/:slug/details", fh.GetInfo())
+	e.POST("/api/forum/:slug/details", fh.ChangeHandler())
+	e.DELETE("/api/forum/:slug", fh.RemoveHandler())
+	e.GET("/api/forum/:slug/export", fh.ExportHandler())
+	e.GET("/api/forum/:slug/children", fh.GetChildren())
 	e.GET("/api/forum/:slug/threads", fh.GetThreads())
+	e.GET("/api/forum/:slug/tags", fh.GetTags())
+	e.GET("/api/forum/:slug/stats", fh.GetActivity())
 	e.GET("/api/forum/:slug/users", fh.GetUsers())
+	e.GET("/api/forum/:slug/moderators", fh.GetModerators())
+	e.POST("/api/forum/:slug/moderators", fh.AddModerator())
+	e.DELETE("/api/forum/:slug/moderators/:nickname", fh.RemoveModerator())
+	e.GET("/api/forum/:slug/members", fh.GetMembers())
+	e.POST("/api/forum/:slug/members", fh.AddMember())
+	e.DELETE("/api/forum/:slug/members/:nickname", fh.RemoveMember())
+	e.GET("/api/forum/:slug/bans", fh.GetBans())
+	e.POST("/api/forum/:slug/bans", fh.BanHandler())
+	e.DELETE("/api/forum/:slug/bans/:nickname", fh.UnbanHandler())
 }
 
 type Message struct {
-	Message string `json:"message"`
+	Message string   `json:"message"`
+	Fields  []string `json:"fields,omitempty"`
 }
 
 func (fh *ForumHandler) CreateHandler() echo.HandlerFunc {
 	type Request struct {
-		Title string `json:"title"`
-		User  string `json:"user"`
-		Slug  string `json:"slug"`
+		Title      string `json:"title" validate:"required"`
+		User       string `json:"user" validate:"required,nickname"`
+		Slug       string `json:"slug" validate:"required,slug"`
+		Parent     string `json:"parent" validate:"omitempty,slug"`
+		Visibility string `json:"visibility" validate:"omitempty,oneof=public private hidden"`
 	}
 	return func(cntx echo.Context) error {
 		req := &Request{}
 		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
 			//logrus.Info(err.DebugMessage)
-			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
 		}
 
 		forum := &models.Forum{
-			Title: req.Title,
-			User:  req.User,
-			Slug:  req.Slug,
+			Title:      req.Title,
+			User:       req.User,
+			Slug:       req.Slug,
+			Parent:     req.Parent,
+			Visibility: req.Visibility,
 		}
 
-		createdForum, err := fh.forumUseCase.Create(forum)
+		createdForum, err := fh.forumUseCase.Create(forum, caller.Get(cntx))
 		if err == errors.Get(consts.CodeForumAlreadyExist) {
 			return cntx.JSON(err.HTTPCode, createdForum)
 		} else if err == errors.Get(consts.CodeUserDoesNotExist) {
@@ -67,18 +91,84 @@ func (fh *ForumHandler) GetInfo() echo.HandlerFunc {
 	return func(cntx echo.Context) error {
 		slug := cntx.Param("slug")
 
-		forum, err := fh.forumUseCase.GetFullDetails(slug)
+		forum, err := fh.forumUseCase.GetFullDetails(slug, caller.Get(cntx))
 		if err != nil {
 			//logrus.Error(err.DebugMessage)
-			return cntx.JSON(err.HTTPCode, Message{err.UserMessage})
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
 		}
 
 		return cntx.JSON(http.StatusOK, forum)
 	}
 }
 
-func (fh *ForumHandler) GetUsers() echo.HandlerFunc {
+func (fh *ForumHandler) GetChildren() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slug := cntx.Param("slug")
+
+		children, err := fh.forumUseCase.GetChildren(slug, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, children)
+	}
+}
+
+func (fh *ForumHandler) ChangeHandler() echo.HandlerFunc {
+	type Request struct {
+		Title      string `json:"title"`
+		User       string `json:"user" validate:"omitempty,nickname"`
+		Visibility string `json:"visibility" validate:"omitempty,oneof=public private hidden"`
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		slug := cntx.Param("slug")
+
+		forum, err := fh.forumUseCase.Change(slug, req.Title, req.User, req.Visibility, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, forum)
+	}
+}
+
+func (fh *ForumHandler) RemoveHandler() echo.HandlerFunc {
 	type Request struct {
+		Mode   string `query:"mode" validate:"omitempty,oneof=archive delete"`
+		DryRun bool   `query:"dry_run"`
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		slug := cntx.Param("slug")
+
+		removal, err := fh.forumUseCase.Remove(slug, req.Mode, req.DryRun, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, removal)
+	}
+}
+
+func (fh *ForumHandler) GetForums() echo.HandlerFunc {
+	type Request struct {
+		Sort  string `query:"sort" validate:"omitempty,oneof=slug created posts threads"`
 		Since string `query:"since"`
 		models.Pagination
 	}
@@ -87,15 +177,68 @@ func (fh *ForumHandler) GetUsers() echo.HandlerFunc {
 		req := &Request{}
 		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
 			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		forums, err := fh.forumUseCase.GetForums(req.Sort, req.Since, &req.Pagination)
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, forums)
+	}
+}
+
+func (fh *ForumHandler) ExportHandler() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slug := cntx.Param("slug")
+
+		writer := newNDJSONArchiveWriter(cntx.Response())
+		err := fh.forumUseCase.Export(slug, writer, caller.Get(cntx))
+		if err != nil && !cntx.Response().Committed {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		// a broken stream lacks the end record, importers reject it
+		return nil
+	}
+}
+
+func (fh *ForumHandler) ImportHandler() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		reader := newNDJSONArchiveReader(cntx.Request().Body)
+
+		report, err := fh.forumUseCase.Import(reader, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
 			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
 		}
 
+		return cntx.JSON(http.StatusCreated, report)
+	}
+}
+
+func (fh *ForumHandler) GetUsers() echo.HandlerFunc {
+	type Request struct {
+		Since string `query:"since"`
+		models.Pagination
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
 		slug := cntx.Param("slug")
 
-		users, err := fh.forumUseCase.GetUsers(slug, req.Since, &req.Pagination)
+		users, err := fh.forumUseCase.GetUsers(slug, req.Since, &req.Pagination, caller.Get(cntx))
 		if err != nil {
 			//logrus.Error(err.DebugMessage)
-			return cntx.JSON(err.HTTPCode, Message{err.UserMessage})
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
 		}
 
 		return cntx.JSON(http.StatusOK, users)
@@ -105,6 +248,7 @@ func (fh *ForumHandler) GetUsers() echo.HandlerFunc {
 func (fh *ForumHandler) GetThreads() echo.HandlerFunc {
 	type Request struct {
 		Since string `query:"since"`
+		Tag   string `query:"tag" validate:"omitempty,slug"`
 		models.Pagination
 	}
 
@@ -112,17 +256,223 @@ func (fh *ForumHandler) GetThreads() echo.HandlerFunc {
 		req := &Request{}
 		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
 			//logrus.Info(err.DebugMessage)
-			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
 		}
 
 		slug := cntx.Param("slug")
 
-		threads, err := fh.forumUseCase.GetThreads(slug, req.Since, &req.Pagination)
+		threads, err := fh.forumUseCase.GetThreads(slug, req.Tag, req.Since, &req.Pagination, caller.Get(cntx))
 		if err != nil {
 			//logrus.Error(err.DebugMessage)
-			return cntx.JSON(err.HTTPCode, Message{err.UserMessage})
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
 		}
 
 		return cntx.JSON(http.StatusOK, threads)
 	}
 }
+
+func (fh *ForumHandler) GetTags() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slug := cntx.Param("slug")
+
+		tags, err := fh.forumUseCase.GetTags(slug, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, tags)
+	}
+}
+
+func (fh *ForumHandler) GetActivity() echo.HandlerFunc {
+	type Request struct {
+		From   *time.Time `query:"from"`
+		To     *time.Time `query:"to"`
+		Bucket string     `query:"bucket" validate:"omitempty,oneof=hour day week"`
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		slug := cntx.Param("slug")
+
+		activity, err := fh.forumUseCase.GetActivity(slug, req.Bucket, req.From, req.To, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		return cntx.JSON(http.StatusOK, activity)
+	}
+}
+
+func (fh *ForumHandler) GetModerators() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slug := cntx.Param("slug")
+
+		moderators, err := fh.forumUseCase.GetModerators(slug, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, moderators)
+	}
+}
+
+func (fh *ForumHandler) AddModerator() echo.HandlerFunc {
+	type Request struct {
+		Moderator string `json:"nickname" validate:"required,nickname"`
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		slug := cntx.Param("slug")
+
+		moderator, err := fh.forumUseCase.AddModerator(slug, req.Moderator, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusCreated, moderator)
+	}
+}
+
+func (fh *ForumHandler) RemoveModerator() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slug := cntx.Param("slug")
+		nickname := cntx.Param("nickname")
+
+		err := fh.forumUseCase.RemoveModerator(slug, nickname, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, "")
+	}
+}
+
+func (fh *ForumHandler) GetMembers() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slug := cntx.Param("slug")
+
+		members, err := fh.forumUseCase.GetMembers(slug, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, members)
+	}
+}
+
+func (fh *ForumHandler) AddMember() echo.HandlerFunc {
+	type Request struct {
+		Member string `json:"nickname" validate:"required,nickname"`
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		slug := cntx.Param("slug")
+
+		member, err := fh.forumUseCase.AddMember(slug, req.Member, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusCreated, member)
+	}
+}
+
+func (fh *ForumHandler) RemoveMember() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slug := cntx.Param("slug")
+		nickname := cntx.Param("nickname")
+
+		err := fh.forumUseCase.RemoveMember(slug, nickname, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, "")
+	}
+}
+
+func (fh *ForumHandler) GetBans() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slug := cntx.Param("slug")
+
+		bans, err := fh.forumUseCase.GetBans(slug, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, bans)
+	}
+}
+
+func (fh *ForumHandler) BanHandler() echo.HandlerFunc {
+	type Request struct {
+		Banned  string     `json:"nickname" validate:"required,nickname"`
+		Reason  string     `json:"reason"`
+		Expires *time.Time `json:"expires"`
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		ban := &models.Ban{
+			Nickname: req.Banned,
+			Forum:    cntx.Param("slug"),
+			Reason:   req.Reason,
+			Expires:  req.Expires,
+		}
+
+		createdBan, err := fh.forumUseCase.Ban(ban, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusCreated, createdBan)
+	}
+}
+
+func (fh *ForumHandler) UnbanHandler() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slug := cntx.Param("slug")
+		nickname := cntx.Param("nickname")
+
+		err := fh.forumUseCase.Unban(slug, nickname, caller.Get(cntx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, "")
+	}
+}
@@ -2,15 +2,34 @@ package forum
 
 import (
 	"github.com/technopark_database/internal/models"
+	"time"
 )
 
 type ForumRepository interface {
 	Insert(forum *models.Forum) error
+	Update(forum *models.Forum) error
 	InsertUserForum(nickname string, slug string) error
 	Select(slug string) (*models.Forum, error)
 	UpdatePostsCount(slug string, count int) error
 	SelectFull(slug string) (*models.Forum, error)
 	SelectUserForum(nickname string, slug string) (string, string, error)
 	SelectUsers(slug string, limit int, since string, desc bool) ([]*models.User, error)
-	SelectThreads(slug string, limit int, since string, desc bool) ([]*models.Thread, error)
+	SelectForums(sort string, limit int, since string, desc bool) ([]*models.Forum, error)
+	SelectChildren(slug string) ([]*models.Forum, error)
+	SelectBreadcrumbs(slug string) ([]*models.Breadcrumb, error)
+	SelectActivity(slug string, bucket string, from time.Time, to time.Time) ([]*models.ForumActivity, error)
+	SelectThreads(slug string, tag string, limit int, since string, desc bool) ([]*models.Thread, error)
+	SelectPinnedThreads(forumSlug string, tag string, limit int, desc bool) ([]*models.Thread, error)
+	SelectTags(slug string) ([]*models.ForumTag, error)
+	InsertMember(nickname string, slug string) error
+	DeleteMember(nickname string, slug string) error
+	SelectMembers(slug string) ([]*models.User, error)
+	IsMember(nickname string, slug string) (bool, error)
+	Export(slug string, writer ArchiveWriter) error
+	Import(reader ArchiveReader) (*models.ForumImportReport, error)
+	InsertBan(ban *models.Ban) error
+	DeleteBan(nickname string, slug string) error
+	SelectBans(slug string) ([]*models.Ban, error)
+	SelectRestrictions(nicknames []string, slug string) (bool, bool, error)
+	Remove(removal *models.ForumRemoval) error
 }
@@ -3,12 +3,16 @@ package repository
 import (
 	"context"
 	"database/sql"
+	goerrors "errors"
 	"fmt"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
+	"github.com/technopark_database/internal/consts"
 	"github.com/technopark_database/internal/forum"
 	"github.com/technopark_database/internal/models"
+	"io"
 	"strings"
-	//"time"
+	"time"
 )
 
 type ForumPgRepository struct {
@@ -26,8 +30,33 @@ func (rep *ForumPgRepository) Insert(forum *models.Forum) error {
 	}
 
 	_, err = tx.Exec(`
-		INSERT INTO forums(title, profile, slug) 
-		VALUES($1, $2, $3)`, forum.Title, forum.User, forum.Slug)
+		INSERT INTO forums(title, profile, slug, parent, visibility)
+		VALUES($1, $2, $3, NULLIF($4, ''), $5)`,
+		forum.Title, forum.User, forum.Slug, forum.Parent, forum.Visibility)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (rep *ForumPgRepository) Update(forum *models.Forum) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE forums
+		SET title = $1, profile = $2, visibility = $3
+		WHERE slug = $4`, forum.Title, forum.User, forum.Visibility, forum.Slug)
 	if err != nil {
 		if err := tx.Rollback(); err != nil {
 			logrus.Error(err)
@@ -49,8 +78,10 @@ func (rep *ForumPgRepository) InsertUserForum(nickname string, slug string) erro
 	}
 
 	_, err = tx.Exec(`
-		INSERT INTO user_forum(nickname, slug) 
-		VALUES($1, $2)`, nickname, slug)
+		INSERT INTO user_forum(nickname, slug)
+		VALUES($1, $2)
+		ON CONFLICT (nickname, slug) DO UPDATE
+		SET participant = true`, nickname, slug)
 	if err != nil {
 		if err := tx.Rollback(); err != nil {
 			logrus.Error(err)
@@ -74,7 +105,7 @@ func (rep *ForumPgRepository) UpdatePostsCount(slug string, count int) error {
 	_, err = tx.Exec(`
 		UPDATE forums
 		SET posts = posts + $1
-		WHERE slug=$2`, count, slug)
+		WHERE slug IN (SELECT l.slug FROM forum_lineage($2) l)`, count, slug)
 	if err != nil {
 		if err := tx.Rollback(); err != nil {
 			logrus.Error(err)
@@ -94,7 +125,7 @@ func (rep *ForumPgRepository) SelectUserForum(nickname string, slug string) (str
 	err := rep.db.QueryRow(`
 		SELECT nickname, slug
 		FROM user_forum
-		WHERE slug=$1 AND nickname=$2`,
+		WHERE slug=$1 AND nickname=$2 AND participant`,
 		slug, nickname).Scan(
 		&dbNickname, &dbSlug)
 	if err != nil {
@@ -106,10 +137,11 @@ func (rep *ForumPgRepository) SelectUserForum(nickname string, slug string) (str
 func (rep *ForumPgRepository) Select(slug string) (*models.Forum, error) {
 	forum := &models.Forum{}
 	err := rep.db.QueryRow(`
-		SELECT title, profile, slug
+		SELECT title, profile, slug, coalesce(parent, ''), visibility, archived
 		FROM forums
 		WHERE slug = $1`, slug).Scan(
-		&forum.Title, &forum.User, &forum.Slug)
+		&forum.Title, &forum.User, &forum.Slug, &forum.Parent,
+		&forum.Visibility, &forum.Archived)
 	if err != nil {
 		return nil, err
 	}
@@ -119,44 +151,231 @@ func (rep *ForumPgRepository) Select(slug string) (*models.Forum, error) {
 func (rep *ForumPgRepository) SelectFull(slug string) (*models.Forum, error) {
 	forum := &models.Forum{}
 	err := rep.db.QueryRow(`
-		SELECT title, profile, slug, posts, threads
+		SELECT title, profile, slug, coalesce(parent, ''), visibility,
+		       posts, threads, archived, created
 		FROM forums
 		WHERE slug = $1`, slug).Scan(
-		&forum.Title, &forum.User, &forum.Slug, &forum.Posts, &forum.Threads)
+		&forum.Title, &forum.User, &forum.Slug, &forum.Parent, &forum.Visibility,
+		&forum.Posts, &forum.Threads, &forum.Archived, &forum.Created)
 	if err != nil {
 		return nil, err
 	}
 	return forum, nil
 }
 
-func (rep *ForumPgRepository) SelectThreads(forumSlug string,
+var forumSortColumns = map[string]string{
+	consts.ForumSortSlug:    "slug",
+	consts.ForumSortCreated: "created",
+	consts.ForumSortPosts:   "posts",
+	consts.ForumSortThreads: "threads",
+}
+
+// lists forums that aren't archived or hidden ordered by the sort key and slug,
+// since is the slug of the last forum on the previous page
+func (rep *ForumPgRepository) SelectForums(sort string, limit int,
+	since string, desc bool) ([]*models.Forum, error) {
+	column, ok := forumSortColumns[sort]
+	if !ok {
+		column = forumSortColumns[consts.ForumSortSlug]
+	}
+
+	query := `
+		SELECT title, profile, slug, coalesce(parent, ''), visibility,
+		       posts, threads, created
+		FROM forums
+		WHERE NOT archived AND visibility <> 'hidden'`
+	var values []interface{}
+
+	i := 1
+	if since != "" {
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		if column == "slug" {
+			query = strings.Join([]string{query,
+				fmt.Sprintf("AND slug %s $1", op)}, " ")
+		} else {
+			query = strings.Join([]string{query,
+				fmt.Sprintf("AND (%[1]s, slug) %[2]s (SELECT %[1]s, slug FROM forums WHERE slug = $1)",
+					column, op)}, " ")
+		}
+		values = append(values, since)
+		i++
+	}
+
+	direction := ""
+	if desc {
+		direction = " DESC"
+	}
+	if column == "slug" {
+		query = strings.Join([]string{query,
+			fmt.Sprintf("ORDER BY slug%s", direction)}, " ")
+	} else {
+		query = strings.Join([]string{query,
+			fmt.Sprintf("ORDER BY %[1]s%[2]s, slug%[2]s", column, direction)}, " ")
+	}
+	query = strings.Join([]string{query,
+		fmt.Sprintf("LIMIT $%d", i)}, " ")
+	values = append(values, limit)
+
+	rows, err := rep.db.Query(query, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	forums := []*models.Forum{}
+	for rows.Next() {
+		forum := &models.Forum{}
+		err := rows.Scan(&forum.Title, &forum.User, &forum.Slug, &forum.Parent,
+			&forum.Visibility, &forum.Posts, &forum.Threads, &forum.Created)
+		if err != nil {
+			return nil, err
+		}
+		forums = append(forums, forum)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return forums, nil
+}
+
+func (rep *ForumPgRepository) SelectChildren(slug string) ([]*models.Forum, error) {
+	rows, err := rep.db.Query(`
+		SELECT title, profile, slug, parent, visibility, posts, threads, created
+		FROM forums
+		WHERE parent = $1 AND NOT archived AND visibility <> 'hidden'
+		ORDER BY slug`, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	forums := []*models.Forum{}
+	for rows.Next() {
+		forum := &models.Forum{}
+		err := rows.Scan(&forum.Title, &forum.User, &forum.Slug, &forum.Parent,
+			&forum.Visibility, &forum.Posts, &forum.Threads, &forum.Created)
+		if err != nil {
+			return nil, err
+		}
+		forums = append(forums, forum)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return forums, nil
+}
+
+// ancestors of the forum starting from the category
+func (rep *ForumPgRepository) SelectBreadcrumbs(slug string) ([]*models.Breadcrumb, error) {
+	rows, err := rep.db.Query(`
+		SELECT f.slug, f.title
+		FROM forum_lineage($1) l
+		JOIN forums f on f.slug = l.slug
+		WHERE l.depth > 0
+		ORDER BY l.depth DESC`, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breadcrumbs := []*models.Breadcrumb{}
+	for rows.Next() {
+		breadcrumb := &models.Breadcrumb{}
+		if err := rows.Scan(&breadcrumb.Slug, &breadcrumb.Title); err != nil {
+			return nil, err
+		}
+		breadcrumbs = append(breadcrumbs, breadcrumb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return breadcrumbs, nil
+}
+
+// sums up hourly activity into buckets within [from, to),
+// bucket is one of the date_trunc fields
+func (rep *ForumPgRepository) SelectActivity(slug string, bucket string,
+	from time.Time, to time.Time) ([]*models.ForumActivity, error) {
+	rows, err := rep.db.Query(`
+		WITH counters AS (
+			SELECT date_trunc($2, hour) AS bucket,
+			       sum(posts) AS posts, sum(threads) AS threads, sum(votes) AS votes
+			FROM forum_activity
+			WHERE forum = $1 AND hour >= $3 AND hour < $4
+			GROUP BY 1
+		), active AS (
+			SELECT date_trunc($2, hour) AS bucket,
+			       count(DISTINCT nickname) AS users
+			FROM forum_activity_users
+			WHERE forum = $1 AND hour >= $3 AND hour < $4
+			GROUP BY 1
+		)
+		SELECT c.bucket, c.posts, c.threads, c.votes, coalesce(a.users, 0)
+		FROM counters c
+		LEFT JOIN active a on a.bucket = c.bucket
+		ORDER BY c.bucket`, slug, bucket, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activity := []*models.ForumActivity{}
+	for rows.Next() {
+		point := &models.ForumActivity{}
+		err := rows.Scan(&point.Bucket, &point.Posts, &point.Threads,
+			&point.Votes, &point.Users)
+		if err != nil {
+			return nil, err
+		}
+		activity = append(activity, point)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return activity, nil
+}
+
+func (rep *ForumPgRepository) SelectThreads(forumSlug string, tag string,
 	limit int, since string, desc bool) ([]*models.Thread, error) {
 	query := `
-		SELECT t.id, t.title, t.author, t.forum, t.message, t.votes, t.slug, t.created
+		SELECT t.id, t.title, t.author, t.forum, t.message, t.votes, t.slug, t.created,
+		       t.locked, t.pinned, t.announcement, t.tags
 		FROM forums f
 		JOIN threads t on t.forum=f.slug
-		WHERE forum = $1`
+		WHERE t.forum = $1 AND t.deleted_at IS NULL
+		  AND NOT t.pinned AND NOT t.announcement`
 
 	var values []interface{}
 	values = append(values, forumSlug)
 
 	i := 2
 
+	if tag != "" {
+		query = strings.Join([]string{query,
+			fmt.Sprintf("AND t.tags @> ARRAY[$%d]::text[]", i),
+		}, " ")
+		i++
+		values = append(values, tag)
+	}
+
 	if since != "" {
 		if desc {
 			query = strings.Join([]string{query,
-				"AND created<=$2",
+				fmt.Sprintf("AND t.created<=$%d", i),
 			}, " ")
 		} else {
 			query = strings.Join([]string{query,
-				"AND created>=$2",
+				fmt.Sprintf("AND t.created>=$%d", i),
 			}, " ")
 		}
 		i++
 		values = append(values, since)
 	}
 
-	query = strings.Join([]string{query, "ORDER BY created"}, " ")
+	query = strings.Join([]string{query, "ORDER BY t.created"}, " ")
 	if desc {
 		query = strings.Join([]string{query,
 			"DESC",
@@ -176,7 +395,9 @@ func (rep *ForumPgRepository) SelectThreads(forumSlug string,
 	for rows.Next() {
 		thread := &models.Thread{}
 		err := rows.Scan(&thread.ID, &thread.Title, &thread.Author, &thread.Forum,
-			&thread.Message, &thread.Votes, &thread.Slug, &thread.Created)
+			&thread.Message, &thread.Votes, &thread.Slug, &thread.Created,
+			&thread.Locked, &thread.Pinned, &thread.Announcement,
+			pq.Array(&thread.Tags))
 		if err != nil {
 			return nil, err
 		}
@@ -190,6 +411,84 @@ func (rep *ForumPgRepository) SelectThreads(forumSlug string,
 	return threads, nil
 }
 
+// returns announcements from every public forum and threads pinned in this one,
+// newest announcements go first, an empty tag doesn't filter them
+func (rep *ForumPgRepository) SelectPinnedThreads(forumSlug string, tag string,
+	limit int, desc bool) ([]*models.Thread, error) {
+	// announcements of other forums are shown only from the public,
+	// not archived ones
+	query := `
+		SELECT t.id, t.title, t.author, t.forum, t.message, t.votes, t.slug, t.created,
+		       t.locked, t.pinned, t.announcement, t.tags
+		FROM forums f
+		JOIN threads t on t.forum=f.slug
+		WHERE t.deleted_at IS NULL
+		  AND ((t.forum = $1 AND (t.pinned OR t.announcement))
+		    OR (t.announcement AND f.visibility = $2 AND NOT f.archived))
+		  AND ($3 = '' OR t.tags @> ARRAY[$3]::text[])
+		ORDER BY t.announcement DESC, t.created`
+	if desc {
+		query = strings.Join([]string{query,
+			"DESC",
+		}, " ")
+	}
+	query = strings.Join([]string{query, "LIMIT $4"}, " ")
+
+	rows, err := rep.db.Query(query, forumSlug, consts.ForumPublic, tag, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := []*models.Thread{}
+	for rows.Next() {
+		thread := &models.Thread{}
+		err := rows.Scan(&thread.ID, &thread.Title, &thread.Author, &thread.Forum,
+			&thread.Message, &thread.Votes, &thread.Slug, &thread.Created,
+			&thread.Locked, &thread.Pinned, &thread.Announcement,
+			pq.Array(&thread.Tags))
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, thread)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return threads, nil
+}
+
+// tags of the live threads of the forum, the most used go first
+func (rep *ForumPgRepository) SelectTags(slug string) ([]*models.ForumTag, error) {
+	rows, err := rep.db.Query(`
+		SELECT tag, count(*)
+		FROM threads t, unnest(t.tags) tag
+		WHERE t.forum = $1 AND t.deleted_at IS NULL
+		GROUP BY tag
+		ORDER BY count(*) DESC, tag`, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*models.ForumTag{}
+	for rows.Next() {
+		tag := &models.ForumTag{}
+		if err := rows.Scan(&tag.Tag, &tag.Threads); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
 func (rep *ForumPgRepository) SelectUsers(slug string, limit int,
 	since string, desc bool) ([]*models.User, error) {
 	query := `
@@ -197,7 +496,7 @@ func (rep *ForumPgRepository) SelectUsers(slug string, limit int,
 		       u.email
 		FROM user_forum
 		JOIN users u on u.nickname = user_forum.nickname
-		WHERE slug=$1`
+		WHERE slug=$1 AND participant`
 	var values []interface{}
 	values = append(values, slug)
 
@@ -245,3 +544,718 @@ func (rep *ForumPgRepository) SelectUsers(slug string, limit int,
 	}
 	return users, nil
 }
+
+// explicit membership keeps the participation flag of an existing row
+func (rep *ForumPgRepository) InsertMember(nickname string, slug string) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_forum(nickname, slug, participant, member)
+		VALUES ($1, $2, false, true)
+		ON CONFLICT (nickname, slug) DO UPDATE
+		SET member = true`, nickname, slug)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// participants stay in user_forum after their membership is revoked
+func (rep *ForumPgRepository) DeleteMember(nickname string, slug string) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	statements := []string{`
+		UPDATE user_forum
+		SET member = false
+		WHERE slug = $1 AND nickname = $2`, `
+		DELETE FROM user_forum
+		WHERE slug = $1 AND nickname = $2 AND NOT participant`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, slug, nickname); err != nil {
+			if err := tx.Rollback(); err != nil {
+				logrus.Error(err)
+			}
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (rep *ForumPgRepository) SelectMembers(slug string) ([]*models.User, error) {
+	rows, err := rep.db.Query(`
+		SELECT u.id, u.nickname, u.fullname, u.about, u.email
+		FROM user_forum
+		JOIN users u on u.nickname = user_forum.nickname
+		WHERE slug = $1 AND member
+		ORDER BY u.nickname`, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		err := rows.Scan(&user.ID, &user.Nickname,
+			&user.Fullname, &user.About, &user.Email)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (rep *ForumPgRepository) IsMember(nickname string, slug string) (bool, error) {
+	var isMember bool
+	err := rep.db.QueryRow(`
+		SELECT EXISTS(SELECT 1
+		              FROM user_forum
+		              WHERE slug = $1 AND nickname = $2 AND member)`,
+		slug, nickname).Scan(&isMember)
+	if err != nil {
+		return false, err
+	}
+	return isMember, nil
+}
+
+// banning an already banned user replaces the previous ban
+func (rep *ForumPgRepository) InsertBan(ban *models.Ban) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO bans(nickname, forum, reason, expires)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (forum, nickname) DO UPDATE
+		SET reason = excluded.reason,
+		    expires = excluded.expires,
+		    created = now()
+		RETURNING created`,
+		ban.Nickname, ban.Forum, ban.Reason, ban.Expires).Scan(&ban.Created)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (rep *ForumPgRepository) DeleteBan(nickname string, slug string) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM bans
+		WHERE forum = $1 AND nickname = $2`, slug, nickname)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (rep *ForumPgRepository) SelectBans(slug string) ([]*models.Ban, error) {
+	rows, err := rep.db.Query(`
+		SELECT nickname, forum, reason, expires, created
+		FROM bans
+		WHERE forum = $1
+		  AND (expires IS NULL OR expires > now())
+		ORDER BY nickname`, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []*models.Ban{}
+	for rows.Next() {
+		ban := &models.Ban{}
+		err := rows.Scan(&ban.Nickname, &ban.Forum, &ban.Reason,
+			&ban.Expires, &ban.Created)
+		if err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// reports whether the forum is archived and whether any of the users
+// has an active ban in it
+func (rep *ForumPgRepository) SelectRestrictions(nicknames []string, slug string) (bool, bool, error) {
+	var isArchived, isBanned bool
+	err := rep.db.QueryRow(`
+		SELECT archived,
+		       EXISTS(SELECT 1
+		              FROM bans
+		              WHERE forum = $1
+		                AND nickname = ANY ($2::citext[])
+		                AND (expires IS NULL OR expires > now()))
+		FROM forums
+		WHERE slug = $1`,
+		slug, pq.Array(nicknames)).Scan(&isArchived, &isBanned)
+	if err != nil {
+		return false, false, err
+	}
+	return isArchived, isBanned, nil
+}
+
+// counts the forum content and, unless it is a dry run, archives the forum
+// or deletes it together with its threads, posts, votes and members,
+// roles and bans go away with the forum row
+func (rep *ForumPgRepository) Remove(removal *models.ForumRemoval) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`
+		SELECT (SELECT count(*) FROM threads WHERE forum = $1),
+		       (SELECT count(*)
+		        FROM posts
+		        WHERE thread IN (SELECT id FROM threads WHERE forum = $1)),
+		       (SELECT count(*)
+		        FROM votes
+		        WHERE thread_id IN (SELECT id FROM threads WHERE forum = $1)),
+		       (SELECT count(*) FROM user_forum WHERE slug = $1)`,
+		removal.Forum).Scan(&removal.Threads, &removal.Posts,
+		&removal.Votes, &removal.Users)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+
+	if removal.DryRun {
+		return tx.Rollback()
+	}
+
+	type statement struct {
+		query  string
+		values []interface{}
+	}
+	var statements []statement
+	if removal.Mode == consts.ForumRemovalArchive {
+		statements = []statement{
+			{`
+		UPDATE forums
+		SET archived = true
+		WHERE slug = $1`,
+				[]interface{}{removal.Forum}},
+		}
+	} else {
+		// triggers on votes, posts, threads and user_forum
+		// keep thread votes and user stats in sync
+		statements = []statement{
+			// ancestors keep counting the sub-forums, which are handed
+			// over to the parent, soft deleted content is already discounted
+			{`
+		UPDATE forums
+		SET posts   = posts - (SELECT count(*)
+		                       FROM posts
+		                       WHERE thread IN (SELECT id FROM threads WHERE forum = $1)
+		                         AND NOT deleted),
+		    threads = threads - (SELECT count(*)
+		                         FROM threads
+		                         WHERE forum = $1 AND deleted_at IS NULL)
+		WHERE slug IN (SELECT l.slug FROM forum_lineage($1) l WHERE l.depth > 0)`,
+				[]interface{}{removal.Forum}},
+			{`
+		UPDATE forums
+		SET parent = (SELECT parent FROM forums WHERE slug = $1)
+		WHERE parent = $1`,
+				[]interface{}{removal.Forum}},
+			// soft deleted threads are already off the authors' stats,
+			// the delete triggers would take them off once more
+			{`
+		SELECT user_stats_shift(array_agg(id), 1)
+		FROM threads
+		WHERE forum = $1 AND deleted_at IS NOT NULL`,
+				[]interface{}{removal.Forum}},
+			{`
+		DELETE FROM votes
+		WHERE thread_id IN (SELECT id FROM threads WHERE forum = $1)`,
+				[]interface{}{removal.Forum}},
+			{`
+		DELETE FROM posts
+		WHERE thread IN (SELECT id FROM threads WHERE forum = $1)`,
+				[]interface{}{removal.Forum}},
+			{`
+		DELETE FROM threads
+		WHERE forum = $1`,
+				[]interface{}{removal.Forum}},
+			{`
+		DELETE FROM user_forum
+		WHERE slug = $1`,
+				[]interface{}{removal.Forum}},
+			{`
+		DELETE FROM forums
+		WHERE slug = $1`,
+				[]interface{}{removal.Forum}},
+		}
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement.query, statement.values...); err != nil {
+			if err := tx.Rollback(); err != nil {
+				logrus.Error(err)
+			}
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// writes the forum with its threads, posts, votes and every user they refer to,
+// all of them are read from the same snapshot, soft deleted threads are left out
+func (rep *ForumPgRepository) Export(slug string, writer forum.ArchiveWriter) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := exportForum(tx, slug, writer); err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func exportForum(tx *sql.Tx, slug string, writer forum.ArchiveWriter) error {
+	exported := &models.Forum{}
+	err := tx.QueryRow(`
+		SELECT title, profile, slug, coalesce(parent, ''), visibility, archived, created
+		FROM forums
+		WHERE slug = $1`, slug).Scan(
+		&exported.Title, &exported.User, &exported.Slug, &exported.Parent,
+		&exported.Visibility, &exported.Archived, &exported.Created)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT nickname, fullname, about, email
+		FROM users
+		WHERE nickname = $2
+		   OR nickname IN (SELECT author
+		                   FROM threads
+		                   WHERE forum = $1 AND deleted_at IS NULL)
+		   OR nickname IN (SELECT author
+		                   FROM posts
+		                   WHERE thread IN (SELECT id
+		                                    FROM threads
+		                                    WHERE forum = $1 AND deleted_at IS NULL))
+		   OR id IN (SELECT user_id
+		             FROM votes
+		             WHERE thread_id IN (SELECT id
+		                                 FROM threads
+		                                 WHERE forum = $1 AND deleted_at IS NULL))
+		ORDER BY nickname`, slug, exported.User)
+	err = exportRows(rows, err, writer, func(rows *sql.Rows) (*models.ArchiveRecord, error) {
+		user := &models.User{}
+		err := rows.Scan(&user.Nickname, &user.Fullname, &user.About, &user.Email)
+		return &models.ArchiveRecord{Type: consts.ArchiveUser, User: user}, err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writer.Write(&models.ArchiveRecord{Type: consts.ArchiveForum, Forum: exported})
+	if err != nil {
+		return err
+	}
+
+	rows, err = tx.Query(`
+		SELECT id, title, author, forum, message, votes, slug, created, locked,
+		       pinned, announcement, tags
+		FROM threads
+		WHERE forum = $1 AND deleted_at IS NULL
+		ORDER BY id`, slug)
+	err = exportRows(rows, err, writer, func(rows *sql.Rows) (*models.ArchiveRecord, error) {
+		thread := &models.Thread{}
+		err := rows.Scan(&thread.ID, &thread.Title, &thread.Author, &thread.Forum,
+			&thread.Message, &thread.Votes, &thread.Slug, &thread.Created,
+			&thread.Locked, &thread.Pinned, &thread.Announcement,
+			pq.Array(&thread.Tags))
+		return &models.ArchiveRecord{Type: consts.ArchiveThread, Thread: thread}, err
+	})
+	if err != nil {
+		return err
+	}
+
+	// paths of replies start with the paths of their parents, so parents
+	// are written first, ids say nothing once posts are merged or split
+	rows, err = tx.Query(`
+		SELECT id, parent, author, message, isedited, forum, thread, created
+		FROM posts
+		WHERE thread IN (SELECT id FROM threads WHERE forum = $1 AND deleted_at IS NULL)
+		ORDER BY thread, path`, slug)
+	err = exportRows(rows, err, writer, func(rows *sql.Rows) (*models.ArchiveRecord, error) {
+		post := &models.Post{}
+		err := rows.Scan(&post.ID, &post.Parent, &post.Author, &post.Message,
+			&post.IsEdited, &post.Forum, &post.Thread, &post.Created)
+		return &models.ArchiveRecord{Type: consts.ArchivePost, Post: post}, err
+	})
+	if err != nil {
+		return err
+	}
+
+	rows, err = tx.Query(`
+		SELECT v.thread_id, u.nickname, CASE WHEN v.likes THEN 1 ELSE -1 END
+		FROM votes v
+		JOIN users u on u.id = v.user_id
+		WHERE v.thread_id IN (SELECT id FROM threads WHERE forum = $1 AND deleted_at IS NULL)
+		ORDER BY v.thread_id, u.nickname`, slug)
+	err = exportRows(rows, err, writer, func(rows *sql.Rows) (*models.ArchiveRecord, error) {
+		vote := &models.ArchiveVote{}
+		err := rows.Scan(&vote.Thread, &vote.Nickname, &vote.Voice)
+		return &models.ArchiveRecord{Type: consts.ArchiveVote, Vote: vote}, err
+	})
+	if err != nil {
+		return err
+	}
+
+	return writer.Write(&models.ArchiveRecord{Type: consts.ArchiveEnd})
+}
+
+func exportRows(rows *sql.Rows, err error, writer forum.ArchiveWriter,
+	scan func(rows *sql.Rows) (*models.ArchiveRecord, error)) error {
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// replays an archive in a single transaction, threads and posts get new ids,
+// users already present under the same nickname are reused
+func (rep *ForumPgRepository) Import(reader forum.ArchiveReader) (*models.ForumImportReport, error) {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := importForum(tx, reader)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		// references to rows missing from the archive
+		var pqErr *pq.Error
+		if goerrors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return nil, fmt.Errorf("%w: %s", forum.ErrMalformedArchive, pqErr.Message)
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+var archiveOrder = map[string]int{
+	consts.ArchiveUser:   0,
+	consts.ArchiveForum:  1,
+	consts.ArchiveThread: 2,
+	consts.ArchivePost:   3,
+	consts.ArchiveVote:   4,
+	consts.ArchiveEnd:    5,
+}
+
+func importForum(tx *sql.Tx, reader forum.ArchiveReader) (*models.ForumImportReport, error) {
+	report := &models.ForumImportReport{}
+	threadIDs := map[uint64]uint64{}
+	postIDs := map[uint64]uint64{}
+
+	stage := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: end record is missing", forum.ErrMalformedArchive)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkArchiveRecord(record); err != nil {
+			return nil, err
+		}
+		if archiveOrder[record.Type] < stage {
+			return nil, fmt.Errorf("%w: %s record is out of order",
+				forum.ErrMalformedArchive, record.Type)
+		}
+		stage = archiveOrder[record.Type]
+		if stage > archiveOrder[consts.ArchiveForum] && report.Forum == "" {
+			return nil, fmt.Errorf("%w: forum record is missing", forum.ErrMalformedArchive)
+		}
+
+		switch record.Type {
+		case consts.ArchiveUser:
+			isCreated, err := importUser(tx, record.User)
+			if err != nil {
+				return nil, err
+			}
+			if isCreated {
+				report.Users++
+			}
+		case consts.ArchiveForum:
+			if report.Forum != "" {
+				return nil, fmt.Errorf("%w: more than one forum record", forum.ErrMalformedArchive)
+			}
+			if err := importForumRow(tx, record.Forum); err != nil {
+				return nil, err
+			}
+			report.Forum = record.Forum.Slug
+		case consts.ArchiveThread:
+			thread := record.Thread
+			thread.Forum = report.Forum
+			id, err := importThread(tx, thread)
+			if err != nil {
+				return nil, err
+			}
+			threadIDs[thread.ID] = id
+			report.Threads++
+		case consts.ArchivePost:
+			post := record.Post
+			threadID, ok := threadIDs[post.Thread]
+			if !ok {
+				return nil, fmt.Errorf("%w: post %d refers to unknown thread %d",
+					forum.ErrMalformedArchive, post.ID, post.Thread)
+			}
+			parentID, ok := postIDs[post.Parent]
+			if post.Parent != 0 && !ok {
+				return nil, fmt.Errorf("%w: post %d refers to unknown parent %d",
+					forum.ErrMalformedArchive, post.ID, post.Parent)
+			}
+
+			var id uint64
+			err := tx.QueryRow(`
+				INSERT INTO posts(parent, author, message, isedited, forum, thread, created)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				RETURNING id`,
+				parentID, post.Author, post.Message, post.IsEdited,
+				report.Forum, threadID, post.Created).Scan(&id)
+			if err != nil {
+				return nil, err
+			}
+			postIDs[post.ID] = id
+			report.Posts++
+		case consts.ArchiveVote:
+			vote := record.Vote
+			threadID, ok := threadIDs[vote.Thread]
+			if !ok {
+				return nil, fmt.Errorf("%w: vote refers to unknown thread %d",
+					forum.ErrMalformedArchive, vote.Thread)
+			}
+
+			// votes_ins_upd trigger restores threads.votes and karma
+			result, err := tx.Exec(`
+				INSERT INTO votes(thread_id, user_id, likes)
+				SELECT $1, id, $3
+				FROM users
+				WHERE nickname = $2
+				ON CONFLICT DO NOTHING`, threadID, vote.Nickname, vote.Voice > 0)
+			if err != nil {
+				return nil, err
+			}
+			if inserted, err := result.RowsAffected(); err != nil {
+				return nil, err
+			} else if inserted == 0 {
+				return nil, fmt.Errorf("%w: vote of %s on thread %d can't be replayed",
+					forum.ErrMalformedArchive, vote.Nickname, vote.Thread)
+			}
+			report.Votes++
+		case consts.ArchiveEnd:
+			// forums.posts is maintained by the application, not by a trigger
+			_, err := tx.Exec(`
+				UPDATE forums
+				SET posts = posts + $2
+				WHERE slug IN (SELECT l.slug FROM forum_lineage($1) l)`,
+				report.Forum, report.Posts)
+			if err != nil {
+				return nil, err
+			}
+			return report, nil
+		}
+	}
+}
+
+func checkArchiveRecord(record *models.ArchiveRecord) error {
+	var isValid bool
+	switch record.Type {
+	case consts.ArchiveUser:
+		isValid = record.User != nil && record.User.Nickname != "" && record.User.Email != ""
+	case consts.ArchiveForum:
+		isValid = record.Forum != nil && record.Forum.Slug != "" && record.Forum.User != ""
+		if isValid {
+			switch record.Forum.Visibility {
+			case "":
+				record.Forum.Visibility = consts.ForumPublic
+			case consts.ForumPublic, consts.ForumPrivate, consts.ForumHidden:
+			default:
+				isValid = false
+			}
+		}
+	case consts.ArchiveThread:
+		isValid = record.Thread != nil
+	case consts.ArchivePost:
+		isValid = record.Post != nil
+	case consts.ArchiveVote:
+		isValid = record.Vote != nil && (record.Vote.Voice == 1 || record.Vote.Voice == -1)
+	case consts.ArchiveEnd:
+		isValid = true
+	}
+
+	if !isValid {
+		return fmt.Errorf("%w: invalid %q record", forum.ErrMalformedArchive, record.Type)
+	}
+	return nil
+}
+
+func importUser(tx *sql.Tx, user *models.User) (bool, error) {
+	var id uint64
+	err := tx.QueryRow(`
+		INSERT INTO users(nickname, fullname, about, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+		RETURNING id`,
+		user.Nickname, user.Fullname, user.About, user.Email).Scan(&id)
+	if err == nil {
+		return true, nil
+	} else if err != sql.ErrNoRows {
+		return false, err
+	}
+
+	// the email may belong to somebody else
+	var isReused bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM users WHERE nickname = $1)`,
+		user.Nickname).Scan(&isReused)
+	if err != nil {
+		return false, err
+	}
+	if !isReused {
+		return false, fmt.Errorf("%w: email of user %s is taken",
+			forum.ErrArchiveConflict, user.Nickname)
+	}
+	return false, nil
+}
+
+// the parent link is kept only if the parent forum exists here
+func importForumRow(tx *sql.Tx, imported *models.Forum) error {
+	var isTaken bool
+	err := tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM forums WHERE slug = $1)`,
+		imported.Slug).Scan(&isTaken)
+	if err != nil {
+		return err
+	}
+	if isTaken {
+		return fmt.Errorf("%w: forum %s already exists",
+			forum.ErrArchiveConflict, imported.Slug)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO forums(title, profile, slug, parent, visibility, archived, created)
+		VALUES ($1, $2, $3, (SELECT slug FROM forums WHERE slug = NULLIF($4, '')),
+		        $5, $6, coalesce($7, now()))`,
+		imported.Title, imported.User, imported.Slug, imported.Parent,
+		imported.Visibility, imported.Archived, imported.Created)
+	return err
+}
+
+func importThread(tx *sql.Tx, thread *models.Thread) (uint64, error) {
+	if thread.Slug != "" {
+		var isTaken bool
+		err := tx.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM threads WHERE slug = $1)`,
+			thread.Slug).Scan(&isTaken)
+		if err != nil {
+			return 0, err
+		}
+		if isTaken {
+			return 0, fmt.Errorf("%w: thread %s already exists",
+				forum.ErrArchiveConflict, thread.Slug)
+		}
+	}
+
+	// votes start from zero and are restored by the vote records
+	var id uint64
+	err := tx.QueryRow(`
+		INSERT INTO threads(title, author, forum, message, votes, slug, created,
+		                    locked, pinned, announcement, tags)
+		VALUES ($1, $2, $3, $4, 0, $5, $6, $7, $8, $9, coalesce($10::text[], '{}'))
+		RETURNING id`,
+		thread.Title, thread.Author, thread.Forum, thread.Message,
+		thread.Slug, thread.Created, thread.Locked, thread.Pinned,
+		thread.Announcement, pq.Array(thread.Tags)).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"github.com/technopark_database/internal/models"
+	threadRepository "github.com/technopark_database/internal/thread/repository"
+	"github.com/technopark_database/tools/pgtest"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestSelectThreadsSince(t *testing.T) {
+	db := pgtest.Open(t)
+	pgtest.Exec(t, db, `
+		INSERT INTO users(nickname, fullname, about, email)
+		VALUES ('alice', 'Alice', '', 'alice@example.com')`, `
+		INSERT INTO forums(title, profile, slug, created)
+		VALUES ('Forum', 'alice', 'forum', '2021-01-01T00:00:00Z')`, `
+		INSERT INTO threads(title, author, forum, message, votes, slug, created)
+		VALUES ('First', 'alice', 'forum', '', 0, 'first', '2021-01-01T01:00:00Z'),
+		       ('Second', 'alice', 'forum', '', 0, 'second', '2021-01-01T02:00:00Z'),
+		       ('Third', 'alice', 'forum', '', 0, 'third', '2021-01-01T03:00:00Z')`)
+	rep := NewForumPgRepository(db)
+
+	tests := []struct {
+		name  string
+		since string
+		desc  bool
+		slugs []string
+	}{
+		{"ascending", "", false, []string{"first", "second", "third"}},
+		{"descending", "", true, []string{"third", "second", "first"}},
+		{"ascending since", "2021-01-01T02:00:00Z", false, []string{"second", "third"}},
+		{"descending since", "2021-01-01T02:00:00Z", true, []string{"second", "first"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			threads, err := rep.SelectThreads("forum", "", 10, test.since, test.desc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(threads) != len(test.slugs) {
+				t.Fatalf("got %d threads, want %d", len(threads), len(test.slugs))
+			}
+			for i, thread := range threads {
+				if thread.Slug != test.slugs[i] {
+					t.Errorf("thread %d is %q, want %q", i, thread.Slug, test.slugs[i])
+				}
+			}
+		})
+	}
+}
+
+type archiveBuffer struct {
+	records []*models.ArchiveRecord
+}
+
+func (buffer *archiveBuffer) Write(record *models.ArchiveRecord) error {
+	buffer.records = append(buffer.records, record)
+	return nil
+}
+
+func (buffer *archiveBuffer) Read() (*models.ArchiveRecord, error) {
+	if len(buffer.records) == 0 {
+		return nil, io.EOF
+	}
+	record := buffer.records[0]
+	buffer.records = buffer.records[1:]
+	return record, nil
+}
+
+// merged roots get parents with greater ids, the archive has to replay
+// them after their parents anyway
+func TestExportImportAfterMerge(t *testing.T) {
+	db := pgtest.Open(t)
+	pgtest.Exec(t, db, `
+		INSERT INTO users(nickname, fullname, about, email)
+		VALUES ('alice', 'Alice', '', 'alice@example.com')`, `
+		INSERT INTO forums(title, profile, slug)
+		VALUES ('Forum', 'alice', 'forum')`, `
+		INSERT INTO threads(id, title, author, forum, message, votes, slug, created)
+		VALUES (1, 'Target', 'alice', 'forum', '', 0, 'target', now()),
+		       (2, 'Source', 'alice', 'forum', '', 0, 'source', now())`, `
+		INSERT INTO posts(id, parent, author, message, forum, thread, created)
+		VALUES (1, 0, 'alice', 'source root', 'forum', 2, now())`, `
+		INSERT INTO posts(id, parent, author, message, forum, thread, created)
+		VALUES (2, 1, 'alice', 'source reply', 'forum', 2, now())`, `
+		INSERT INTO posts(id, parent, author, message, forum, thread, created)
+		VALUES (3, 0, 'alice', 'target root', 'forum', 1, now())`, `
+		SELECT setval('threads_id_seq', 2), setval('posts_id_seq', 3)`)
+
+	if err := threadRepository.NewThreadPgRepository(db).Merge(1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	rep := NewForumPgRepository(db)
+	archive := &archiveBuffer{}
+	if err := rep.Export("forum", archive); err != nil {
+		t.Fatal(err)
+	}
+	// replayed next to the original under other slugs
+	for _, record := range archive.records {
+		if record.Forum != nil {
+			record.Forum.Slug = "copy"
+		}
+		if record.Thread != nil {
+			record.Thread.Slug = "copy-" + record.Thread.Slug
+		}
+	}
+	if _, err := rep.Import(archive); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(`
+		SELECT p.message, coalesce(parent.message, '')
+		FROM posts p
+		LEFT JOIN posts parent on parent.id = p.parent
+		WHERE p.forum = 'copy'
+		ORDER BY p.path`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var tree [][2]string
+	for rows.Next() {
+		var post [2]string
+		if err := rows.Scan(&post[0], &post[1]); err != nil {
+			t.Fatal(err)
+		}
+		tree = append(tree, post)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][2]string{
+		{"target root", ""},
+		{"source root", "target root"},
+		{"source reply", "source root"},
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("imported tree is %v, want %v", tree, want)
+	}
+}
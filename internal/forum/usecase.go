@@ -3,14 +3,36 @@ package forum
 import (
 	"github.com/technopark_database/internal/helpers/errors"
 	"github.com/technopark_database/internal/models"
+	"time"
 )
 
 type ForumUseCase interface {
-	Create(forum *models.Forum) (*models.Forum, *errors.Error)
+	Create(forum *models.Forum, caller *models.User) (*models.Forum, *errors.Error)
+	Change(slug string, title string, owner string, visibility string, caller *models.User) (*models.Forum, *errors.Error)
 	AddForumUser(nickname string, slug string) *errors.Error
 	GetDetails(slug string) (*models.Forum, *errors.Error)
-	GetFullDetails(slug string) (*models.Forum, *errors.Error)
+	GetFullDetails(slug string, caller *models.User) (*models.Forum, *errors.Error)
+	GetChildren(slug string, caller *models.User) ([]*models.Forum, *errors.Error)
+	GetActivity(slug string, bucket string, from *time.Time, to *time.Time,
+		caller *models.User) ([]*models.ForumActivity, *errors.Error)
 	UpdatePosts(slug string, count int) *errors.Error
-	GetUsers(slug string, since string, pagination *models.Pagination) ([]*models.User, *errors.Error)
-	GetThreads(slug string, since string, pagination *models.Pagination) ([]*models.Thread, *errors.Error)
+	GetForums(sort string, since string, pagination *models.Pagination) ([]*models.Forum, *errors.Error)
+	GetUsers(slug string, since string, pagination *models.Pagination, caller *models.User) ([]*models.User, *errors.Error)
+	GetThreads(slug string, tag string, since string, pagination *models.Pagination,
+		caller *models.User) ([]*models.Thread, *errors.Error)
+	GetTags(slug string, caller *models.User) ([]*models.ForumTag, *errors.Error)
+	GetModerators(slug string, caller *models.User) ([]*models.User, *errors.Error)
+	AddModerator(slug string, nickname string, caller *models.User) (*models.User, *errors.Error)
+	RemoveModerator(slug string, nickname string, caller *models.User) *errors.Error
+	GetMembers(slug string, caller *models.User) ([]*models.User, *errors.Error)
+	AddMember(slug string, nickname string, caller *models.User) (*models.User, *errors.Error)
+	RemoveMember(slug string, nickname string, caller *models.User) *errors.Error
+	Export(slug string, writer ArchiveWriter, caller *models.User) *errors.Error
+	Import(reader ArchiveReader, caller *models.User) (*models.ForumImportReport, *errors.Error)
+	GetBans(slug string, caller *models.User) ([]*models.Ban, *errors.Error)
+	Ban(ban *models.Ban, caller *models.User) (*models.Ban, *errors.Error)
+	Unban(slug string, nickname string, caller *models.User) *errors.Error
+	CheckReadable(slug string, caller *models.User) *errors.Error
+	CheckWritable(slug string, nicknames []string) *errors.Error
+	Remove(slug string, mode string, dryRun bool, caller *models.User) (*models.ForumRemoval, *errors.Error)
 }
@@ -2,23 +2,36 @@ package usecases
 
 import (
 	"database/sql"
+	goerrors "errors"
+	"github.com/technopark_database/internal/auth"
 	"github.com/technopark_database/internal/consts"
 	"github.com/technopark_database/internal/forum"
 	"github.com/technopark_database/internal/helpers/errors"
 	"github.com/technopark_database/internal/models"
 	"github.com/technopark_database/internal/user"
+	"strings"
+	"time"
 )
 
+// activity is reported for the last month unless the period is given
+const defaultActivityPeriod = 30 * 24 * time.Hour
+
 type ForumUseCase struct {
 	rep         forum.ForumRepository
 	userUseCase user.UserUseCase
+	authUseCase auth.AuthUseCase
 }
 
-func NewForumUseCase(rep forum.ForumRepository, userUseCase user.UserUseCase) forum.ForumUseCase {
-	return &ForumUseCase{rep: rep, userUseCase: userUseCase}
+func NewForumUseCase(rep forum.ForumRepository, userUseCase user.UserUseCase,
+	authUseCase auth.AuthUseCase) forum.ForumUseCase {
+	return &ForumUseCase{rep: rep, userUseCase: userUseCase, authUseCase: authUseCase}
 }
 
-func (uc *ForumUseCase) Create(forum *models.Forum) (*models.Forum, *errors.Error) {
+func (uc *ForumUseCase) Create(forum *models.Forum, caller *models.User) (*models.Forum, *errors.Error) {
+	if customErr := uc.authUseCase.CheckActor(caller, forum.User); customErr != nil {
+		return nil, customErr
+	}
+
 	dbUser, customErr := uc.userUseCase.GetUserInfo(forum.User)
 	if customErr != nil {
 		return nil, customErr
@@ -33,12 +46,58 @@ func (uc *ForumUseCase) Create(forum *models.Forum) (*models.Forum, *errors.Erro
 		return dbForum, errors.Get(consts.CodeForumAlreadyExist)
 	}
 
+	if forum.Visibility == "" {
+		forum.Visibility = consts.ForumPublic
+	}
+	if forum.Parent != "" {
+		parent, customErr := uc.GetDetails(forum.Parent)
+		if customErr != nil {
+			return nil, customErr
+		}
+		if parent.Archived {
+			return nil, errors.Get(consts.CodeForumArchived)
+		}
+		forum.Parent = parent.Slug
+	}
+
 	if err := uc.rep.Insert(forum); err != nil {
 		return nil, errors.New(consts.CodeInternalServerError, err)
 	}
 	return forum, nil
 }
 
+// updates the title and visibility and hands the forum over to another user,
+// empty values are left unchanged
+func (uc *ForumUseCase) Change(slug string, title string, owner string, visibility string,
+	caller *models.User) (*models.Forum, *errors.Error) {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.authUseCase.CheckOwner(caller, forum.User); customErr != nil {
+		return nil, customErr
+	}
+
+	if owner != "" {
+		newOwner, customErr := uc.userUseCase.GetUserInfo(owner)
+		if customErr != nil {
+			return nil, customErr
+		}
+		forum.User = newOwner.Nickname
+	}
+	if title != "" {
+		forum.Title = title
+	}
+	if visibility != "" {
+		forum.Visibility = visibility
+	}
+
+	if err := uc.rep.Update(forum); err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return uc.GetFullDetails(forum.Slug, caller)
+}
+
 func (uc *ForumUseCase) AddForumUser(nickname string, slug string) *errors.Error {
 	_, _, err := uc.rep.SelectUserForum(nickname, slug)
 	if err == sql.ErrNoRows {
@@ -63,22 +122,72 @@ func (uc *ForumUseCase) GetDetails(slug string) (*models.Forum, *errors.Error) {
 	return forum, nil
 }
 
-func (uc *ForumUseCase) GetFullDetails(slug string) (*models.Forum, *errors.Error) {
+func (uc *ForumUseCase) GetFullDetails(slug string, caller *models.User) (*models.Forum, *errors.Error) {
 	forum, err := uc.rep.SelectFull(slug)
 	if err == sql.ErrNoRows {
 		return nil, errors.Get(consts.CodeForumDoesNotExist)
 	} else if err != nil {
 		return nil, errors.New(consts.CodeInternalServerError, err)
 	}
+	if customErr := uc.checkVisible(forum, caller); customErr != nil {
+		return nil, customErr
+	}
 
+	if forum.Parent != "" {
+		forum.Breadcrumbs, err = uc.rep.SelectBreadcrumbs(forum.Slug)
+		if err != nil {
+			return nil, errors.New(consts.CodeInternalServerError, err)
+		}
+	}
 	return forum, nil
 }
 
-func (uc *ForumUseCase) GetUsers(slug string, since string, pagination *models.Pagination) ([]*models.User, *errors.Error) {
-	_, customErr := uc.GetDetails(slug)
+func (uc *ForumUseCase) GetChildren(slug string, caller *models.User) ([]*models.Forum, *errors.Error) {
+	forum, customErr := uc.GetDetails(slug)
 	if customErr != nil {
 		return nil, customErr
 	}
+	if customErr := uc.checkVisible(forum, caller); customErr != nil {
+		return nil, customErr
+	}
+
+	children, err := uc.rep.SelectChildren(forum.Slug)
+	if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return children, nil
+}
+
+func (uc *ForumUseCase) GetForums(sort string, since string, pagination *models.Pagination) ([]*models.Forum, *errors.Error) {
+	if pagination.Limit == 0 {
+		pagination.Limit = 100
+	}
+	if sort == "" {
+		sort = consts.ForumSortSlug
+	}
+
+	if since != "" {
+		if _, customErr := uc.GetDetails(since); customErr != nil {
+			return nil, customErr
+		}
+	}
+
+	forums, err := uc.rep.SelectForums(sort, pagination.Limit, since, pagination.Desc)
+	if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return forums, nil
+}
+
+func (uc *ForumUseCase) GetUsers(slug string, since string, pagination *models.Pagination,
+	caller *models.User) ([]*models.User, *errors.Error) {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.checkReader(forum, caller); customErr != nil {
+		return nil, customErr
+	}
 
 	users, err := uc.rep.SelectUsers(slug, pagination.Limit, since, pagination.Desc)
 	if err == sql.ErrNoRows {
@@ -91,18 +200,38 @@ func (uc *ForumUseCase) GetUsers(slug string, since string, pagination *models.P
 	return users, nil
 }
 
-func (uc *ForumUseCase) GetThreads(slug string, since string, pagination *models.Pagination) ([]*models.Thread, *errors.Error) {
+func (uc *ForumUseCase) GetThreads(slug string, tag string, since string, pagination *models.Pagination,
+	caller *models.User) ([]*models.Thread, *errors.Error) {
 	if pagination.Limit == 0 {
 		pagination.Limit = 100
 	}
 
-	if _, err := uc.GetDetails(slug); err != nil {
-		return nil, err
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.checkReader(forum, caller); customErr != nil {
+		return nil, customErr
 	}
 
-	threads, err := uc.rep.SelectThreads(slug, pagination.Limit, since, pagination.Desc)
-	if err != nil {
-		return nil, errors.New(consts.CodeInternalServerError, err)
+	tag = strings.ToLower(tag)
+	// pinned threads head the first page only and take their share
+	// of the limit, so since keeps paging over the regular threads
+	var pinned []*models.Thread
+	if since == "" {
+		var err error
+		pinned, err = uc.rep.SelectPinnedThreads(slug, tag, pagination.Limit, pagination.Desc)
+		if err != nil {
+			return nil, errors.New(consts.CodeInternalServerError, err)
+		}
+	}
+	threads := pinned
+	if limit := pagination.Limit - len(pinned); limit > 0 {
+		regular, err := uc.rep.SelectThreads(slug, tag, limit, since, pagination.Desc)
+		if err != nil {
+			return nil, errors.New(consts.CodeInternalServerError, err)
+		}
+		threads = append(threads, regular...)
 	}
 	if len(threads) == 0 {
 		return []*models.Thread{}, nil
@@ -110,6 +239,25 @@ func (uc *ForumUseCase) GetThreads(slug string, since string, pagination *models
 	return threads, nil
 }
 
+func (uc *ForumUseCase) GetTags(slug string, caller *models.User) ([]*models.ForumTag, *errors.Error) {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.checkReader(forum, caller); customErr != nil {
+		return nil, customErr
+	}
+
+	tags, err := uc.rep.SelectTags(forum.Slug)
+	if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	if len(tags) == 0 {
+		return []*models.ForumTag{}, nil
+	}
+	return tags, nil
+}
+
 func (uc *ForumUseCase) IsExist(slug string) (*models.Forum, *errors.Error) {
 	dbForum, err := uc.rep.Select(slug)
 	if err == sql.ErrNoRows {
@@ -121,6 +269,38 @@ func (uc *ForumUseCase) IsExist(slug string) (*models.Forum, *errors.Error) {
 	return nil, nil
 }
 
+func (uc *ForumUseCase) GetActivity(slug string, bucket string,
+	from *time.Time, to *time.Time, caller *models.User) ([]*models.ForumActivity, *errors.Error) {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.checkReader(forum, caller); customErr != nil {
+		return nil, customErr
+	}
+
+	if bucket == "" {
+		bucket = consts.ActivityBucketDay
+	}
+	periodEnd := time.Now()
+	if to != nil {
+		periodEnd = *to
+	}
+	periodStart := periodEnd.Add(-defaultActivityPeriod)
+	if from != nil {
+		periodStart = *from
+	}
+	if !periodStart.Before(periodEnd) {
+		return nil, errors.NewFieldsError([]string{"from", "to"})
+	}
+
+	activity, err := uc.rep.SelectActivity(forum.Slug, bucket, periodStart, periodEnd)
+	if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return activity, nil
+}
+
 func (uc *ForumUseCase) UpdatePosts(slug string, count int) *errors.Error {
 	err := uc.rep.UpdatePostsCount(slug, count)
 	if err != nil {
@@ -128,3 +308,275 @@ func (uc *ForumUseCase) UpdatePosts(slug string, count int) *errors.Error {
 	}
 	return nil
 }
+
+func (uc *ForumUseCase) GetModerators(slug string, caller *models.User) ([]*models.User, *errors.Error) {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.checkReader(forum, caller); customErr != nil {
+		return nil, customErr
+	}
+
+	return uc.authUseCase.GetModerators(forum.Slug)
+}
+
+// moderators are appointed by the forum owner or by admins
+func (uc *ForumUseCase) AddModerator(slug string, nickname string,
+	caller *models.User) (*models.User, *errors.Error) {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.authUseCase.CheckOwner(caller, forum.User); customErr != nil {
+		return nil, customErr
+	}
+
+	moderator, customErr := uc.userUseCase.GetUserInfo(nickname)
+	if customErr != nil {
+		return nil, customErr
+	}
+
+	customErr = uc.authUseCase.GrantRole(moderator.Nickname, consts.RoleModerator, forum.Slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	return moderator, nil
+}
+
+func (uc *ForumUseCase) RemoveModerator(slug string, nickname string, caller *models.User) *errors.Error {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return customErr
+	}
+	if customErr := uc.authUseCase.CheckOwner(caller, forum.User); customErr != nil {
+		return customErr
+	}
+
+	return uc.authUseCase.RevokeRole(nickname, consts.RoleModerator, forum.Slug)
+}
+
+func (uc *ForumUseCase) GetMembers(slug string, caller *models.User) ([]*models.User, *errors.Error) {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.checkReader(forum, caller); customErr != nil {
+		return nil, customErr
+	}
+
+	members, err := uc.rep.SelectMembers(forum.Slug)
+	if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return members, nil
+}
+
+func (uc *ForumUseCase) AddMember(slug string, nickname string,
+	caller *models.User) (*models.User, *errors.Error) {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.authUseCase.CheckModerator(caller, forum.Slug); customErr != nil {
+		return nil, customErr
+	}
+
+	member, customErr := uc.userUseCase.GetUserInfo(nickname)
+	if customErr != nil {
+		return nil, customErr
+	}
+
+	if err := uc.rep.InsertMember(member.Nickname, forum.Slug); err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return member, nil
+}
+
+// members may leave on their own, others are removed by moderators
+func (uc *ForumUseCase) RemoveMember(slug string, nickname string, caller *models.User) *errors.Error {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return customErr
+	}
+	if customErr := uc.authUseCase.CheckActor(caller, nickname); customErr != nil {
+		if customErr := uc.authUseCase.CheckModerator(caller, forum.Slug); customErr != nil {
+			return customErr
+		}
+	}
+
+	if err := uc.rep.DeleteMember(nickname, forum.Slug); err != nil {
+		return errors.New(consts.CodeInternalServerError, err)
+	}
+	return nil
+}
+
+func (uc *ForumUseCase) Export(slug string, writer forum.ArchiveWriter, caller *models.User) *errors.Error {
+	exported, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return customErr
+	}
+	if customErr := uc.authUseCase.CheckOwner(caller, exported.User); customErr != nil {
+		return customErr
+	}
+
+	if err := uc.rep.Export(exported.Slug, writer); err != nil {
+		return errors.New(consts.CodeInternalServerError, err)
+	}
+	return nil
+}
+
+// archives create users and keep their timestamps, so only admins replay them
+func (uc *ForumUseCase) Import(reader forum.ArchiveReader,
+	caller *models.User) (*models.ForumImportReport, *errors.Error) {
+	if customErr := uc.authUseCase.CheckAdmin(caller); customErr != nil {
+		return nil, customErr
+	}
+
+	report, err := uc.rep.Import(reader)
+	if goerrors.Is(err, forum.ErrMalformedArchive) {
+		return nil, errors.New(consts.CodeBadRequest, err)
+	} else if goerrors.Is(err, forum.ErrArchiveConflict) {
+		return nil, errors.New(consts.CodeArchiveConflict, err)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return report, nil
+}
+
+func (uc *ForumUseCase) GetBans(slug string, caller *models.User) ([]*models.Ban, *errors.Error) {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.authUseCase.CheckModerator(caller, forum.Slug); customErr != nil {
+		return nil, customErr
+	}
+
+	bans, err := uc.rep.SelectBans(forum.Slug)
+	if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return bans, nil
+}
+
+func (uc *ForumUseCase) Ban(ban *models.Ban, caller *models.User) (*models.Ban, *errors.Error) {
+	forum, customErr := uc.GetDetails(ban.Forum)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.authUseCase.CheckModerator(caller, forum.Slug); customErr != nil {
+		return nil, customErr
+	}
+
+	bannedUser, customErr := uc.userUseCase.GetUserInfo(ban.Nickname)
+	if customErr != nil {
+		return nil, customErr
+	}
+	ban.Nickname = bannedUser.Nickname
+	ban.Forum = forum.Slug
+
+	if err := uc.rep.InsertBan(ban); err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return ban, nil
+}
+
+func (uc *ForumUseCase) Unban(slug string, nickname string, caller *models.User) *errors.Error {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return customErr
+	}
+	if customErr := uc.authUseCase.CheckModerator(caller, forum.Slug); customErr != nil {
+		return customErr
+	}
+
+	if err := uc.rep.DeleteBan(nickname, forum.Slug); err != nil {
+		return errors.New(consts.CodeInternalServerError, err)
+	}
+	return nil
+}
+
+// fails if the forum is archived or any of the users has an active ban in it
+func (uc *ForumUseCase) CheckWritable(slug string, nicknames []string) *errors.Error {
+	isArchived, isBanned, err := uc.rep.SelectRestrictions(nicknames, slug)
+	if err == sql.ErrNoRows {
+		return errors.Get(consts.CodeForumDoesNotExist)
+	} else if err != nil {
+		return errors.New(consts.CodeInternalServerError, err)
+	}
+	if isArchived {
+		return errors.Get(consts.CodeForumArchived)
+	}
+	if isBanned {
+		return errors.Get(consts.CodeUserBanned)
+	}
+	return nil
+}
+
+// archives or deletes the forum, a dry run only reports what would be affected
+func (uc *ForumUseCase) Remove(slug string, mode string, dryRun bool,
+	caller *models.User) (*models.ForumRemoval, *errors.Error) {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.authUseCase.CheckOwner(caller, forum.User); customErr != nil {
+		return nil, customErr
+	}
+
+	if mode == "" {
+		mode = consts.ForumRemovalArchive
+	}
+	removal := &models.ForumRemoval{
+		Forum:  forum.Slug,
+		Mode:   mode,
+		DryRun: dryRun,
+	}
+	if err := uc.rep.Remove(removal); err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return removal, nil
+}
+
+func (uc *ForumUseCase) CheckReadable(slug string, caller *models.User) *errors.Error {
+	forum, customErr := uc.GetDetails(slug)
+	if customErr != nil {
+		return customErr
+	}
+	return uc.checkReader(forum, caller)
+}
+
+// content of non-public forums is shown to members, moderators and the owner,
+// hidden forums pretend not to exist for everyone else
+func (uc *ForumUseCase) checkReader(forum *models.Forum, caller *models.User) *errors.Error {
+	if forum.Visibility == consts.ForumPublic {
+		return nil
+	}
+
+	if caller != nil {
+		isMember, err := uc.rep.IsMember(caller.Nickname, forum.Slug)
+		if err != nil {
+			return errors.New(consts.CodeInternalServerError, err)
+		}
+		if isMember {
+			return nil
+		}
+	}
+	if customErr := uc.authUseCase.CheckModerator(caller, forum.Slug); customErr == nil {
+		return nil
+	}
+
+	if forum.Visibility == consts.ForumHidden {
+		return errors.Get(consts.CodeForumDoesNotExist)
+	}
+	return errors.Get(consts.CodeForumMembersOnly)
+}
+
+// private forums stay visible, only their content is restricted
+func (uc *ForumUseCase) checkVisible(forum *models.Forum, caller *models.User) *errors.Error {
+	if forum.Visibility != consts.ForumHidden {
+		return nil
+	}
+	return uc.checkReader(forum, caller)
+}
@@ -0,0 +1,18 @@
+package caller
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/technopark_database/internal/models"
+)
+
+const contextKey = "caller"
+
+func Set(cntx echo.Context, user *models.User) {
+	cntx.Set(contextKey, user)
+}
+
+// returns nil for anonymous requests
+func Get(cntx echo.Context) *models.User {
+	user, _ := cntx.Get(contextKey).(*models.User)
+	return user
+}
@@ -3,6 +3,7 @@ package errors
 import (
 	. "github.com/technopark_database/internal/consts"
 	"net/http"
+	"strings"
 )
 
 type Error struct {
@@ -10,6 +11,7 @@ type Error struct {
 	HTTPCode     int       `json:"-"`
 	DebugMessage string    `json:"debug_message"`
 	UserMessage  string    `json:"message"`
+	Fields       []string  `json:"fields,omitempty"`
 }
 
 var WrongErrorCode = &Error{
@@ -27,6 +29,15 @@ func New(code ErrorCode, err error) *Error {
 	return customErr
 }
 
+// returns a copy of the bad request error listing
+// request fields which didn't pass validation
+func NewFieldsError(fields []string) *Error {
+	customErr := *Errors[CodeBadRequest]
+	customErr.DebugMessage = "invalid fields: " + strings.Join(fields, ", ")
+	customErr.Fields = fields
+	return &customErr
+}
+
 func Get(code ErrorCode) *Error {
 	err, has := Errors[code]
 	if !has {
@@ -120,4 +131,52 @@ var Errors = map[ErrorCode]*Error{
 		DebugMessage: "thread with this slug already exist",
 		UserMessage:  "thread already exist",
 	},
+	CodeUnauthorized: {
+		Code:         CodeUnauthorized,
+		HTTPCode:     http.StatusUnauthorized,
+		DebugMessage: "missing or expired token",
+		UserMessage:  "Authentication required",
+	},
+	CodeForbidden: {
+		Code:         CodeForbidden,
+		HTTPCode:     http.StatusForbidden,
+		DebugMessage: "caller doesn't match acting user",
+		UserMessage:  "Action isn't allowed for this user",
+	},
+	CodeWrongCredentials: {
+		Code:         CodeWrongCredentials,
+		HTTPCode:     http.StatusUnauthorized,
+		DebugMessage: "wrong nickname or password",
+		UserMessage:  "Wrong nickname or password",
+	},
+	CodeUserBanned: {
+		Code:         CodeUserBanned,
+		HTTPCode:     http.StatusForbidden,
+		DebugMessage: "user has an active ban in this forum",
+		UserMessage:  "User is banned in this forum",
+	},
+	CodeForumArchived: {
+		Code:         CodeForumArchived,
+		HTTPCode:     http.StatusForbidden,
+		DebugMessage: "forum is archived and read-only",
+		UserMessage:  "Forum is archived",
+	},
+	CodeForumMembersOnly: {
+		Code:         CodeForumMembersOnly,
+		HTTPCode:     http.StatusForbidden,
+		DebugMessage: "caller isn't a member of the private forum",
+		UserMessage:  "Forum is visible to members only",
+	},
+	CodeArchiveConflict: {
+		Code:         CodeArchiveConflict,
+		HTTPCode:     http.StatusConflict,
+		DebugMessage: "imported forum, thread or user clashes with existing data",
+		UserMessage:  "Archive conflicts with existing data",
+	},
+	CodeThreadLocked: {
+		Code:         CodeThreadLocked,
+		HTTPCode:     http.StatusForbidden,
+		DebugMessage: "thread is locked by a moderator",
+		UserMessage:  "Thread is locked",
+	},
 }
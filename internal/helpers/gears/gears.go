@@ -47,3 +47,57 @@ func AddPagination(query string, values []interface{},
 
 	return query, values
 }
+
+// pages over (created, id) of the table, since is the id of the last row
+// seen, created doesn't have to follow the ids of imported or split rows
+func AddKeysetPagination(query string, values []interface{}, table string,
+	pagination *models.Pagination, since uint64, i int) (string, []interface{}) {
+	order := ""
+	if pagination.Desc {
+		order = " DESC"
+	}
+
+	if since != 0 {
+		char := ">"
+		if pagination.Desc {
+			char = "<"
+		}
+		query = strings.Join([]string{query,
+			fmt.Sprintf("AND (created, id) %s (SELECT created, id FROM %s WHERE id = $%d)", char, table, i),
+		}, " ")
+		i++
+		values = append(values, since)
+	}
+
+	query = strings.Join([]string{query,
+		fmt.Sprintf("ORDER BY created%[1]s, id%[1]s LIMIT $%[2]d", order, i),
+	}, " ")
+	values = append(values, pagination.Limit)
+
+	return query, values
+}
+
+// keeps rows of public forums and of the forums the reader is a member,
+// owner or moderator of, readerID is 0 for anonymous readers
+func AddReadableForum(query string, values []interface{},
+	forumColumn string, readerID uint64, i int) (string, []interface{}) {
+	filter := fmt.Sprintf(`AND EXISTS(
+		SELECT 1
+		FROM forums rf
+		WHERE rf.slug = %[1]s
+		  AND (rf.visibility = 'public'
+		    OR rf.profile = (SELECT nickname FROM users WHERE id = $%[2]d)
+		    OR EXISTS(SELECT 1
+		              FROM user_forum uf
+		              JOIN users ru on ru.nickname = uf.nickname
+		              WHERE uf.slug = rf.slug AND ru.id = $%[2]d AND uf.member)
+		    OR EXISTS(SELECT 1
+		              FROM roles r
+		              WHERE r.user_id = $%[2]d
+		                AND (r.role = 'admin' OR (r.role = 'moderator' AND r.forum = rf.slug)))))`,
+		forumColumn, i)
+	query = strings.Join([]string{query, filter}, " ")
+	values = append(values, readerID)
+
+	return query, values
+}
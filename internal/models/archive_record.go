@@ -0,0 +1,18 @@
+package models
+
+// one line of a forum archive, the payload matching the type is set
+type ArchiveRecord struct {
+	Type   string       `json:"type"`
+	User   *User        `json:"user,omitempty"`
+	Forum  *Forum       `json:"forum,omitempty"`
+	Thread *Thread      `json:"thread,omitempty"`
+	Post   *Post        `json:"post,omitempty"`
+	Vote   *ArchiveVote `json:"vote,omitempty"`
+}
+
+// votes refer to users by nickname since ids differ between databases
+type ArchiveVote struct {
+	Thread   uint64 `json:"thread"`
+	Nickname string `json:"nickname"`
+	Voice    int    `json:"voice"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type Ban struct {
+	Nickname string     `json:"nickname"`
+	Forum    string     `json:"forum"`
+	Reason   string     `json:"reason"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	Created  time.Time  `json:"created"`
+}
@@ -0,0 +1,6 @@
+package models
+
+type Breadcrumb struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
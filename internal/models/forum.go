@@ -1,9 +1,16 @@
 package models
 
+import "time"
+
 type Forum struct {
-	Title   string `json:"title"`
-	User    string `json:"user"`
-	Slug    string `json:"slug"`
-	Posts   int    `json:"posts"`
-	Threads int    `json:"threads"`
+	Title       string        `json:"title"`
+	User        string        `json:"user"`
+	Slug        string        `json:"slug"`
+	Parent      string        `json:"parent,omitempty"`
+	Visibility  string        `json:"visibility,omitempty"`
+	Posts       int           `json:"posts"`
+	Threads     int           `json:"threads"`
+	Archived    bool          `json:"archived,omitempty"`
+	Created     *time.Time    `json:"created,omitempty"`
+	Breadcrumbs []*Breadcrumb `json:"breadcrumbs,omitempty"`
 }
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type ForumActivity struct {
+	Bucket  time.Time `json:"bucket"`
+	Posts   int       `json:"posts"`
+	Threads int       `json:"threads"`
+	Votes   int       `json:"votes"`
+	Users   int       `json:"users"`
+}
@@ -0,0 +1,9 @@
+package models
+
+type ForumImportReport struct {
+	Forum   string `json:"forum"`
+	Users   int    `json:"users"`
+	Threads int    `json:"threads"`
+	Posts   int    `json:"posts"`
+	Votes   int    `json:"votes"`
+}
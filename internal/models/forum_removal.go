@@ -0,0 +1,11 @@
+package models
+
+type ForumRemoval struct {
+	Forum   string `json:"forum"`
+	Mode    string `json:"mode"`
+	DryRun  bool   `json:"dry_run"`
+	Threads int    `json:"threads"`
+	Posts   int    `json:"posts"`
+	Votes   int    `json:"votes"`
+	Users   int    `json:"users"`
+}
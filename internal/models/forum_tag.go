@@ -0,0 +1,6 @@
+package models
+
+type ForumTag struct {
+	Tag     string `json:"tag"`
+	Threads int    `json:"threads"`
+}
@@ -1,6 +1,6 @@
 package models
 
 type Pagination struct {
-	Limit int    `query:"limit"`
+	Limit int    `query:"limit" validate:"gte=0"`
 	Desc  bool   `query:"desc"`
 }
@@ -0,0 +1,21 @@
+package models
+
+type ForumDrift struct {
+	Slug            string `json:"slug"`
+	Posts           int    `json:"posts"`
+	ExpectedPosts   int    `json:"expected_posts"`
+	Threads         int    `json:"threads"`
+	ExpectedThreads int    `json:"expected_threads"`
+}
+
+type ThreadDrift struct {
+	ID            uint64 `json:"id"`
+	Votes         int    `json:"votes"`
+	ExpectedVotes int    `json:"expected_votes"`
+}
+
+type Reconciliation struct {
+	Forums  []*ForumDrift  `json:"forums"`
+	Threads []*ThreadDrift `json:"threads"`
+	Fixed   bool           `json:"fixed"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type Session struct {
+	Token    string     `json:"token"`
+	UserID   uint64     `json:"-"`
+	Nickname string     `json:"nickname"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
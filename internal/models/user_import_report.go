@@ -0,0 +1,6 @@
+package models
+
+type UserImportReport struct {
+	Created   []*User `json:"created"`
+	Conflicts []*User `json:"conflicts"`
+}
@@ -0,0 +1,9 @@
+package models
+
+type UserStats struct {
+	Nickname string `json:"nickname"`
+	Posts    int    `json:"posts"`
+	Threads  int    `json:"threads"`
+	Forums   int    `json:"forums"`
+	Karma    int    `json:"karma"`
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/labstack/echo/v4"
 	//"github.com/sirupsen/logrus"
 	"github.com/technopark_database/internal/consts"
+	"github.com/technopark_database/internal/helpers/caller"
 	"github.com/technopark_database/internal/helpers/errors"
 	"github.com/technopark_database/internal/models"
 	"io/ioutil"
@@ -28,16 +29,21 @@ func (ph *PostHandler) Configure(e *echo.Echo) {
 	e.POST("/api/thread/:slug_or_id/create", ph.CreatePostsHandler())
 	e.GET("/api/thread/:slug_or_id/posts", ph.GetPosts())
 	e.POST("/api/post/:id/details", ph.ChangeHandler())
+	e.POST("/api/post/:id/split", ph.SplitHandler())
 	e.GET("/api/post/:id/details", ph.GetPostDetails())
+	e.GET("/api/user/:nickname/posts", ph.GetUserPosts())
 }
 
 type Message struct {
-	Message string `json:"message"`
+	Message string   `json:"message"`
+	Fields  []string `json:"fields,omitempty"`
 }
 
 func (ph *PostHandler) CreatePostsHandler() echo.HandlerFunc {
 	type Request struct {
-		Posts []*models.Post `json:"posts"`
+		Parent  uint64 `json:"parent"`
+		Author  string `json:"author" validate:"required,nickname"`
+		Message string `json:"message" validate:"required"`
 	}
 	return func(ctx echo.Context) error {
 		body, err := ioutil.ReadAll(ctx.Request().Body)
@@ -47,16 +53,29 @@ func (ph *PostHandler) CreatePostsHandler() echo.HandlerFunc {
 			return ctx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
 		}
 
-		req := []*models.Post{}
+		req := []*Request{}
 		if err := json.Unmarshal(body, &req); err != nil {
-			customErr := errors.New(consts.CodeInternalServerError, err)
+			customErr := errors.New(consts.CodeBadRequest, err)
 			//logrus.Error(customErr.DebugMessage)
 			return ctx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
 		}
+		if err := reader.NewRequestReader(ctx).Validate(req); err != nil {
+			//logrus.Error(err.DebugMessage)
+			return ctx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		posts := []*models.Post{}
+		for _, reqPost := range req {
+			posts = append(posts, &models.Post{
+				Parent:  reqPost.Parent,
+				Author:  reqPost.Author,
+				Message: reqPost.Message,
+			})
+		}
 
 		slugOrID := ctx.Param("slug_or_id")
 
-		createdPosts, customErr := ph.postUseCase.CreateMany(slugOrID, req)
+		createdPosts, customErr := ph.postUseCase.CreateMany(slugOrID, posts, caller.Get(ctx))
 		if customErr != nil {
 			//logrus.Error(customErr.DebugMessage)
 			return ctx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
@@ -73,13 +92,13 @@ func (ph *PostHandler) ChangeHandler() echo.HandlerFunc {
 		req := &Request{}
 		if err := reader.NewRequestReader(ctx).Read(req); err != nil {
 			//logrus.Error(err.DebugMessage)
-			return ctx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+			return ctx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
 		}
 
 		strID := ctx.Param("id")
 		id, _ := strconv.ParseUint(strID, 10, 64)
 
-		post, err := ph.postUseCase.ChangeByID(id, req.Message)
+		post, err := ph.postUseCase.ChangeByID(id, req.Message, caller.Get(ctx))
 		if err != nil {
 			//logrus.Error(err.DebugMessage)
 			return ctx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
@@ -89,9 +108,42 @@ func (ph *PostHandler) ChangeHandler() echo.HandlerFunc {
 	}
 }
 
+func (ph *PostHandler) SplitHandler() echo.HandlerFunc {
+	type Request struct {
+		Title   string `json:"title" validate:"required"`
+		Forum   string `json:"forum"`
+		Message string `json:"message"`
+		Slug    string `json:"slug" validate:"omitempty,slug"`
+	}
+	return func(ctx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(ctx).Read(req); err != nil {
+			//logrus.Error(err.DebugMessage)
+			return ctx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		strID := ctx.Param("id")
+		id, _ := strconv.ParseUint(strID, 10, 64)
+
+		thread := &models.Thread{
+			Title:   req.Title,
+			Forum:   req.Forum,
+			Message: req.Message,
+			Slug:    req.Slug,
+		}
+		createdThread, err := ph.postUseCase.Split(id, thread, caller.Get(ctx))
+		if err != nil {
+			//logrus.Error(err.DebugMessage)
+			return ctx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return ctx.JSON(http.StatusCreated, createdThread)
+	}
+}
+
 func (ph *PostHandler) GetPosts() echo.HandlerFunc {
 	type Request struct {
-		Sort  string `query:"sort"`
+		Sort  string `query:"sort" validate:"omitempty,oneof=flat tree parent_tree"`
 		Since uint64 `query:"since"`
 		models.Pagination
 	}
@@ -99,12 +151,12 @@ func (ph *PostHandler) GetPosts() echo.HandlerFunc {
 		req := &Request{}
 		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
 			//logrus.Error(err.DebugMessage)
-			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
 		}
 
 		slugOrID := cntx.Param("slug_or_id")
 
-		posts, customErr := ph.postUseCase.GetPosts(slugOrID, req.Sort, req.Since, &req.Pagination)
+		posts, customErr := ph.postUseCase.GetPosts(slugOrID, req.Sort, req.Since, &req.Pagination, caller.Get(cntx))
 		if customErr != nil {
 			//logrus.Error(customErr.DebugMessage)
 			return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
@@ -135,7 +187,30 @@ func (ph *PostHandler) GetPostDetails() echo.HandlerFunc {
 		strID := cntx.Param("id")
 		id, _ := strconv.ParseUint(strID, 10, 64)
 
-		posts, customErr := ph.postUseCase.GetPostInfo(id, relatedModel)
+		posts, customErr := ph.postUseCase.GetPostInfo(id, relatedModel, caller.Get(cntx))
+		if customErr != nil {
+			//logrus.Error(customErr.DebugMessage)
+			return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
+		}
+		return cntx.JSON(http.StatusOK, posts)
+	}
+}
+
+func (ph *PostHandler) GetUserPosts() echo.HandlerFunc {
+	type Request struct {
+		Since uint64 `query:"since"`
+		models.Pagination
+	}
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		nickname := cntx.Param("nickname")
+
+		posts, customErr := ph.postUseCase.GetUserPosts(nickname, req.Since, &req.Pagination, caller.Get(cntx))
 		if customErr != nil {
 			//logrus.Error(customErr.DebugMessage)
 			return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
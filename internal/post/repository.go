@@ -5,7 +5,11 @@ import "github.com/technopark_database/internal/models"
 type PostRepository interface {
 	InsertMany(posts []*models.Post) error
 	Update(post *models.Post) error
+	Split(id uint64, thread *models.Thread) error
 	SelectByID(id uint64) (*models.Post, error)
+	SelectSubtreeAuthors(id uint64) ([]string, error)
 	SelectPosts(threadID uint64, sort string, since uint64,
 		pagination *models.Pagination) ([]*models.Post, error)
+	SelectByAuthor(nickname string, since uint64,
+		pagination *models.Pagination, restricted bool, readerID uint64) ([]*models.Post, error)
 }
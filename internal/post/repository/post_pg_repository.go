@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 	"github.com/technopark_database/internal/helpers/gears"
 	"github.com/technopark_database/internal/models"
@@ -80,12 +81,126 @@ func (rep *PostPgRepository) Update(post *models.Post) error {
 	return nil
 }
 
+// creates the thread with the post as its first post and moves the whole
+// subtree of the post there, the subtree paths lose the ancestors' prefix
+func (rep *PostPgRepository) Split(id uint64, thread *models.Thread) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	var oldThread uint64
+	var oldForum string
+	var path []int64
+	err = tx.QueryRow(`
+		SELECT thread, forum, path
+		FROM posts
+		WHERE id = $1 AND NOT deleted
+		FOR UPDATE`, id).Scan(&oldThread, &oldForum, pq.Array(&path))
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			logrus.Info(rollbackErr)
+		}
+		return err
+	}
+
+	// the insert triggers count the thread in its forum lineage
+	// and add the author to the forum participants
+	err = tx.QueryRow(`
+		INSERT INTO threads(title, author, forum, message, votes, slug, created)
+		VALUES ($1, $2, $3, $4, 0, $5, $6)
+		RETURNING id`,
+		thread.Title, thread.Author, thread.Forum, thread.Message,
+		thread.Slug, thread.Created).Scan(&thread.ID)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			logrus.Info(rollbackErr)
+		}
+		return err
+	}
+
+	depth := len(path)
+	result, err := tx.Exec(`
+		UPDATE posts
+		SET thread = $1,
+		    forum  = $2,
+		    parent = CASE WHEN id = $3 THEN 0 ELSE parent END,
+		    path   = path[$4:]
+		WHERE thread = $5 AND path[1] = $6 AND path[1:$4] = $7`,
+		thread.ID, thread.Forum, id, depth, oldThread, path[0], pq.Array(path))
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			logrus.Info(rollbackErr)
+		}
+		return err
+	}
+	posts, err := result.RowsAffected()
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			logrus.Info(rollbackErr)
+		}
+		return err
+	}
+
+	for _, change := range []struct {
+		slug  string
+		posts int64
+	}{{oldForum, -posts}, {thread.Forum, posts}} {
+		_, err = tx.Exec(`
+			UPDATE forums
+			SET posts = posts + $2
+			WHERE slug IN (SELECT l.slug FROM forum_lineage($1) l)`,
+			change.slug, change.posts)
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				logrus.Info(rollbackErr)
+			}
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_forum(nickname, slug)
+		SELECT DISTINCT author, $2
+		FROM posts
+		WHERE thread = $1
+		ON CONFLICT (nickname, slug) DO UPDATE
+		    SET participant = true
+		    WHERE NOT user_forum.participant`, thread.ID, thread.Forum)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			logrus.Info(rollbackErr)
+		}
+		return err
+	}
+
+	// the new thread holds all of the moved posts,
+	// so its hours are the ones to rebuild in both forums
+	if oldForum != thread.Forum {
+		_, err = tx.Exec(`
+			SELECT forum_activity_refresh(f.slug, thread_activity_hours($1))
+			FROM unnest(ARRAY[$2, $3]::citext[]) AS f(slug)`,
+			thread.ID, oldForum, thread.Forum)
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				logrus.Info(rollbackErr)
+			}
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (rep *PostPgRepository) SelectByID(id uint64) (*models.Post, error) {
 	post := &models.Post{}
 	err := rep.db.QueryRow(`
 		SELECT id, parent, author, message, isedited, forum, thread, created
 		FROM posts
-		WHERE id=$1`, id).Scan(&post.ID, &post.Parent, &post.Author, &post.Message,
+		WHERE id=$1 AND NOT deleted`, id).Scan(&post.ID, &post.Parent, &post.Author, &post.Message,
 		&post.IsEdited, &post.Forum, &post.Thread, &post.Created)
 	if err != nil {
 		return nil, err
@@ -93,6 +208,33 @@ func (rep *PostPgRepository) SelectByID(id uint64) (*models.Post, error) {
 	return post, err
 }
 
+func (rep *PostPgRepository) SelectSubtreeAuthors(id uint64) ([]string, error) {
+	rows, err := rep.db.Query(`
+		SELECT DISTINCT s.author
+		FROM posts p
+		         JOIN posts s ON s.thread = p.thread AND s.path[1] = p.path[1]
+		WHERE p.id = $1
+		  AND NOT p.deleted
+		  AND s.path[1:array_length(p.path, 1)] = p.path`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var authors []string
+	for rows.Next() {
+		var author string
+		if err := rows.Scan(&author); err != nil {
+			return nil, err
+		}
+		authors = append(authors, author)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return authors, nil
+}
+
 func (rep *PostPgRepository) selectPostsTree(threadID uint64, since uint64,
 	pagination *models.Pagination) ([]*models.Post, error) {
 	var values []interface{}
@@ -100,7 +242,7 @@ func (rep *PostPgRepository) selectPostsTree(threadID uint64, since uint64,
 	selectQuery := `
 		SELECT id, parent, author, message, isedited, forum, thread, created
 		FROM posts
-		WHERE thread=$1`
+		WHERE thread=$1 AND NOT deleted`
 	values = append(values, threadID)
 
 	var sortQuery string
@@ -173,7 +315,8 @@ func getSelectParentsQuery(threadID uint64,
 		SELECT id
 		FROM posts
 		WHERE thread=$1
-		AND parent=0`
+		AND parent=0
+		AND NOT deleted`
 	values = append(values, threadID)
 
 	var sortQuery string
@@ -266,7 +409,7 @@ func (rep *PostPgRepository) selectPostsFlat(threadID uint64, since uint64,
 		SELECT id, parent, author, message,
        			isedited, forum, thread, created
 		FROM posts
-		WHERE thread=$1`
+		WHERE thread=$1 AND NOT deleted`
 	var values []interface{}
 	values = append(values, threadID)
 
@@ -305,3 +448,45 @@ func (rep *PostPgRepository) SelectPosts(threadID uint64, sort string, since uin
 		return rep.selectPostsFlat(threadID, since, pagination)
 	}
 }
+
+// restricted listings only contain forums readable by the reader
+func (rep *PostPgRepository) SelectByAuthor(nickname string, since uint64,
+	pagination *models.Pagination, restricted bool, readerID uint64) ([]*models.Post, error) {
+	query := `
+		SELECT id, parent, author, message,
+       			isedited, forum, thread, created
+		FROM posts
+		WHERE author=$1 AND NOT deleted`
+	var values []interface{}
+	values = append(values, nickname)
+
+	i := 2
+	if restricted {
+		query, values = gears.AddReadableForum(query, values, "forum", readerID, i)
+		i++
+	}
+
+	query, values = gears.AddKeysetPagination(query, values, "posts", pagination, since, i)
+
+	rows, err := rep.db.Query(query, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*models.Post
+	for rows.Next() {
+		post := &models.Post{}
+		err := rows.Scan(&post.ID, &post.Parent,
+			&post.Author, &post.Message, &post.IsEdited, &post.Forum,
+			&post.Thread, &post.Created)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
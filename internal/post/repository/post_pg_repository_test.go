@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"github.com/technopark_database/internal/models"
+	"github.com/technopark_database/tools/pgtest"
+	"testing"
+)
+
+// split and imported posts get new ids but keep their creation time
+func TestSelectByAuthorPagesInCreationOrder(t *testing.T) {
+	db := pgtest.Open(t)
+	pgtest.Exec(t, db, `
+		INSERT INTO users(nickname, fullname, about, email)
+		VALUES ('alice', 'Alice', '', 'alice@example.com')`, `
+		INSERT INTO forums(title, profile, slug)
+		VALUES ('Forum', 'alice', 'forum')`, `
+		INSERT INTO threads(title, author, forum, message, votes, slug, created)
+		VALUES ('Thread', 'alice', 'forum', '', 0, 'thread', '2021-01-01T00:00:00Z')`, `
+		INSERT INTO posts(parent, author, message, forum, thread, created)
+		VALUES (0, 'alice', 'third', 'forum', 1, '2021-01-01T03:00:00Z'),
+		       (0, 'alice', 'first', 'forum', 1, '2021-01-01T01:00:00Z'),
+		       (0, 'alice', 'second', 'forum', 1, '2021-01-01T02:00:00Z')`)
+	rep := NewPostPgRepository(db)
+
+	for _, test := range []struct {
+		name string
+		desc bool
+		want []string
+	}{
+		{"ascending", false, []string{"first", "second", "third"}},
+		{"descending", true, []string{"third", "second", "first"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			pagination := &models.Pagination{Limit: 1, Desc: test.desc}
+
+			var got []string
+			since := uint64(0)
+			for len(got) <= len(test.want) {
+				posts, err := rep.SelectByAuthor("alice", since, pagination, false, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(posts) == 0 {
+					break
+				}
+				got = append(got, posts[0].Message)
+				since = posts[0].ID
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("got %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
@@ -6,9 +6,12 @@ import (
 )
 
 type PostUseCase interface {
-	CreateMany(slugOrID string, posts []*models.Post) ([]*models.Post, *errors.Error)
-	ChangeByID(id uint64, message string) (*models.Post, *errors.Error)
+	CreateMany(slugOrID string, posts []*models.Post, caller *models.User) ([]*models.Post, *errors.Error)
+	ChangeByID(id uint64, message string, caller *models.User) (*models.Post, *errors.Error)
+	Split(id uint64, thread *models.Thread, caller *models.User) (*models.Thread, *errors.Error)
 	GetPosts(slugOrID string, sort string, since uint64,
-		pagination *models.Pagination) ([]*models.Post, *errors.Error)
-	GetPostInfo(id uint64, related *models.Related) (*models.PostDetails, *errors.Error)
+		pagination *models.Pagination, caller *models.User) ([]*models.Post, *errors.Error)
+	GetPostInfo(id uint64, related *models.Related, caller *models.User) (*models.PostDetails, *errors.Error)
+	GetUserPosts(nickname string, since uint64,
+		pagination *models.Pagination, caller *models.User) ([]*models.Post, *errors.Error)
 }
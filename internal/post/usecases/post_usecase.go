@@ -2,6 +2,7 @@ package usecases
 
 import (
 	"database/sql"
+	"github.com/technopark_database/internal/auth"
 	"github.com/technopark_database/internal/consts"
 	"github.com/technopark_database/internal/forum"
 	"github.com/technopark_database/internal/helpers/errors"
@@ -17,25 +18,32 @@ type PostUseCase struct {
 	rep           post.PostRepository
 	forumUseCase  forum.ForumUseCase
 	userUseCase   user.UserUseCase
+	authUseCase   auth.AuthUseCase
 }
 
 func NewPostUseCase(threadUseCase thread.ThreadUsecase,
 	rep post.PostRepository,
 	forumUseCase forum.ForumUseCase,
-	userUseCase user.UserUseCase) post.PostUseCase {
+	userUseCase user.UserUseCase,
+	authUseCase auth.AuthUseCase) post.PostUseCase {
 	return &PostUseCase{
 		rep:           rep,
 		threadUseCase: threadUseCase,
 		forumUseCase:  forumUseCase,
 		userUseCase:   userUseCase,
+		authUseCase:   authUseCase,
 	}
 }
 
-func (uc *PostUseCase) CreateMany(slugOrID string, posts []*models.Post) ([]*models.Post, *errors.Error) {
+func (uc *PostUseCase) CreateMany(slugOrID string, posts []*models.Post,
+	caller *models.User) ([]*models.Post, *errors.Error) {
 	thread, customErr := uc.GetThreadBySlugOrID(slugOrID)
 	if customErr != nil {
 		return nil, customErr
 	}
+	if thread.Locked {
+		return nil, errors.Get(consts.CodeThreadLocked)
+	}
 
 	if len(posts) == 0 {
 		return []*models.Post{}, nil
@@ -43,6 +51,9 @@ func (uc *PostUseCase) CreateMany(slugOrID string, posts []*models.Post) ([]*mod
 
 	var nicknames []string
 	for _, post := range posts {
+		if customErr := uc.authUseCase.CheckActor(caller, post.Author); customErr != nil {
+			return nil, customErr
+		}
 		nicknames = append(nicknames, post.Author)
 		post.Forum = thread.Forum
 		//post.Created = createdTime
@@ -54,6 +65,11 @@ func (uc *PostUseCase) CreateMany(slugOrID string, posts []*models.Post) ([]*mod
 		return nil, customErr
 	}
 
+	customErr = uc.forumUseCase.CheckWritable(thread.Forum, nicknames)
+	if customErr != nil {
+		return nil, customErr
+	}
+
 	err := uc.rep.InsertMany(posts)
 	if err != nil {
 		if err.Error() == "pq: Parent post does not exist in thread" {
@@ -89,11 +105,14 @@ func (uc *PostUseCase) GetThreadBySlugOrID(slugOrID string) (*models.Thread, *er
 }
 
 func (uc *PostUseCase) GetPosts(slugOrID string, sort string, since uint64,
-	pagination *models.Pagination) ([]*models.Post, *errors.Error) {
+	pagination *models.Pagination, caller *models.User) ([]*models.Post, *errors.Error) {
 	thread, customErr := uc.GetThreadBySlugOrID(slugOrID)
 	if customErr != nil {
 		return nil, customErr
 	}
+	if customErr := uc.forumUseCase.CheckReadable(thread.Forum, caller); customErr != nil {
+		return nil, customErr
+	}
 
 	posts, err := uc.rep.SelectPosts(thread.ID, sort, since, pagination)
 	if err != nil {
@@ -106,7 +125,8 @@ func (uc *PostUseCase) GetPosts(slugOrID string, sort string, since uint64,
 	return posts, nil
 }
 
-func (uc *PostUseCase) ChangeByID(id uint64, message string) (*models.Post, *errors.Error) {
+func (uc *PostUseCase) ChangeByID(id uint64, message string,
+	caller *models.User) (*models.Post, *errors.Error) {
 	post, err := uc.rep.SelectByID(id)
 	if err == sql.ErrNoRows {
 		return nil, errors.Get(consts.CodePostDoesNotExist)
@@ -114,6 +134,13 @@ func (uc *PostUseCase) ChangeByID(id uint64, message string) (*models.Post, *err
 		return nil, errors.New(consts.CodeInternalServerError, err)
 	}
 
+	if customErr := uc.authUseCase.CheckEditor(caller, post.Author, post.Forum); customErr != nil {
+		return nil, customErr
+	}
+	if customErr := uc.forumUseCase.CheckWritable(post.Forum, nil); customErr != nil {
+		return nil, customErr
+	}
+
 	if message == "" || message == post.Message {
 		return post, nil
 	}
@@ -127,7 +154,77 @@ func (uc *PostUseCase) ChangeByID(id uint64, message string) (*models.Post, *err
 	return post, nil
 }
 
-func (uc *PostUseCase) GetPostInfo(id uint64, related *models.Related) (*models.PostDetails, *errors.Error) {
+// moves the post with its replies into a new thread, the thread stays
+// in the forum of the post unless another one is given
+func (uc *PostUseCase) Split(id uint64, thread *models.Thread,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	post, err := uc.rep.SelectByID(id)
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodePostDoesNotExist)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+
+	if thread.Forum == "" {
+		thread.Forum = post.Forum
+	}
+	target, customErr := uc.forumUseCase.GetDetails(thread.Forum)
+	if customErr != nil {
+		return nil, customErr
+	}
+	thread.Forum = target.Slug
+
+	for _, slug := range []string{post.Forum, thread.Forum} {
+		if customErr := uc.authUseCase.CheckModerator(caller, slug); customErr != nil {
+			return nil, customErr
+		}
+	}
+	source, customErr := uc.threadUseCase.GetByID(post.Thread)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if source.Locked {
+		return nil, errors.Get(consts.CodeThreadLocked)
+	}
+	if customErr := uc.forumUseCase.CheckWritable(post.Forum, nil); customErr != nil {
+		return nil, customErr
+	}
+	// every reply follows the post into the target forum
+	authors, err := uc.rep.SelectSubtreeAuthors(post.ID)
+	if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	customErr = uc.forumUseCase.CheckWritable(thread.Forum, authors)
+	if customErr != nil {
+		return nil, customErr
+	}
+
+	if thread.Slug != "" {
+		existedThread, customErr := uc.threadUseCase.GetBySlug(thread.Slug)
+		if customErr != nil && customErr != errors.Get(consts.CodeThreadDoesNotExist) {
+			return nil, customErr
+		} else if existedThread != nil {
+			return nil, errors.Get(consts.CodeThreadAlreadyExist)
+		}
+	}
+
+	thread.Author = post.Author
+	thread.Created = post.Created
+	if thread.Message == "" {
+		thread.Message = post.Message
+	}
+
+	err = uc.rep.Split(post.ID, thread)
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodePostDoesNotExist)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return thread, nil
+}
+
+func (uc *PostUseCase) GetPostInfo(id uint64, related *models.Related,
+	caller *models.User) (*models.PostDetails, *errors.Error) {
 	postDetails := &models.PostDetails{}
 
 	post, err := uc.rep.SelectByID(id)
@@ -136,6 +233,9 @@ func (uc *PostUseCase) GetPostInfo(id uint64, related *models.Related) (*models.
 	} else if err != nil {
 		return nil, errors.New(consts.CodeInternalServerError, err)
 	}
+	if customErr := uc.forumUseCase.CheckReadable(post.Forum, caller); customErr != nil {
+		return nil, customErr
+	}
 	postDetails.Post = post
 
 	if related.User {
@@ -147,7 +247,7 @@ func (uc *PostUseCase) GetPostInfo(id uint64, related *models.Related) (*models.
 	}
 
 	if related.Forum {
-		forum, customErr := uc.forumUseCase.GetFullDetails(post.Forum)
+		forum, customErr := uc.forumUseCase.GetFullDetails(post.Forum, caller)
 		if customErr != nil {
 			return nil, customErr
 		}
@@ -164,3 +264,33 @@ func (uc *PostUseCase) GetPostInfo(id uint64, related *models.Related) (*models.
 
 	return postDetails, nil
 }
+
+func (uc *PostUseCase) GetUserPosts(nickname string, since uint64,
+	pagination *models.Pagination, caller *models.User) ([]*models.Post, *errors.Error) {
+	if pagination.Limit == 0 {
+		pagination.Limit = 100
+	}
+
+	author, customErr := uc.userUseCase.GetUserInfo(nickname)
+	if customErr != nil {
+		return nil, customErr
+	}
+
+	// in open mode every forum is readable
+	restricted := !uc.authUseCase.IsOpen()
+	var readerID uint64
+	if caller != nil {
+		readerID = caller.ID
+	}
+
+	posts, err := uc.rep.SelectByAuthor(author.Nickname, since, pagination,
+		restricted, readerID)
+	if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	if posts == nil {
+		return []*models.Post{}, nil
+	}
+
+	return posts, nil
+}
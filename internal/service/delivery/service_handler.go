@@ -3,7 +3,9 @@ package delivery
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
+	"github.com/technopark_database/internal/helpers/caller"
 	"github.com/technopark_database/internal/service"
+	reader "github.com/technopark_database/tools/requestReader"
 	"net/http"
 )
 
@@ -18,6 +20,7 @@ func NewServiceHandler(serviceUseCase service.ServiceUseCase) *ServiceHandler {
 func (sh *ServiceHandler) Configure(e *echo.Echo) {
 	e.POST("/api/service/clear", sh.ClearHandler())
 	e.GET("/api/service/status", sh.GetStatusHandler())
+	e.POST("/api/service/reconcile", sh.ReconcileHandler())
 }
 
 func (sh *ServiceHandler) ClearHandler() echo.HandlerFunc {
@@ -41,3 +44,23 @@ func (sh *ServiceHandler) GetStatusHandler() echo.HandlerFunc {
 		return cntx.JSON(http.StatusOK, serviceStatus)
 	}
 }
+
+func (sh *ServiceHandler) ReconcileHandler() echo.HandlerFunc {
+	type Request struct {
+		Fix bool `json:"fix"`
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			return cntx.JSON(err.HTTPCode, err.UserMessage)
+		}
+
+		reconciliation, err := sh.serviceUseCase.Reconcile(req.Fix, caller.Get(cntx))
+		if err != nil {
+			logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, err.UserMessage)
+		}
+		return cntx.JSON(http.StatusOK, reconciliation)
+	}
+}
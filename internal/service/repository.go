@@ -5,4 +5,5 @@ import "github.com/technopark_database/internal/models"
 type ServiceRepository interface {
 	Delete() error
 	GetStatus() (*models.ServiceStatus, error)
+	Reconcile(fix bool) (*models.Reconciliation, error)
 }
@@ -3,10 +3,46 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"github.com/sirupsen/logrus"
+	"github.com/technopark_database/internal/consts"
 	"github.com/technopark_database/internal/models"
 	"github.com/technopark_database/internal/service"
 )
 
+// forum counters recomputed from posts and threads that aren't soft deleted,
+// sub-forum content is rolled up to every ancestor
+const expectedForumCounters = `
+	WITH own_posts AS (
+		SELECT forum AS slug, count(*) AS posts
+		FROM posts
+		WHERE NOT deleted
+		GROUP BY forum
+	), own_threads AS (
+		SELECT forum AS slug, count(*) AS threads
+		FROM threads
+		WHERE deleted_at IS NULL
+		GROUP BY forum
+	), own AS (
+		SELECT f.slug, coalesce(p.posts, 0) AS posts, coalesce(t.threads, 0) AS threads
+		FROM forums f
+		LEFT JOIN own_posts p on p.slug = f.slug
+		LEFT JOIN own_threads t on t.slug = f.slug
+	), expected AS (
+		SELECT l.slug, sum(o.posts)::int AS posts, sum(o.threads)::int AS threads
+		FROM own o
+		CROSS JOIN LATERAL forum_lineage(o.slug) l
+		GROUP BY l.slug
+	)`
+
+// thread votes recomputed from the votes table
+const expectedThreadVotes = `
+	WITH expected AS (
+		SELECT t.id, coalesce(sum(CASE WHEN v.likes THEN 1 ELSE -1 END), 0)::int AS votes
+		FROM threads t
+		LEFT JOIN votes v on v.thread_id = t.id
+		GROUP BY t.id
+	)`
+
 type ServicePgRepository struct {
 	db *sql.DB
 }
@@ -18,7 +54,8 @@ func (rep ServicePgRepository) GetStatus() (*models.ServiceStatus, error) {
 		(SELECT count(*) from forums) AS forum,
 		(SELECT count(*) from posts) AS post,
 		(SELECT count(*) from threads) AS thread,
-		(SELECT count(*) from users) AS user`)
+		(SELECT count(*) from users WHERE nickname <> $1) AS user`,
+		consts.DeletedUserNickname)
 
 	err := row.Scan(&serviceStatus.Forum, &serviceStatus.Post,
 		&serviceStatus.Thread, &serviceStatus.User)
@@ -46,9 +83,127 @@ func (rep ServicePgRepository) Delete() error {
 		return err
 	}
 
+	// the reserved account has to outlive the clearing
+	_, err = tx.Exec(`
+		INSERT INTO users(nickname, fullname, about, email)
+		VALUES ($1, $2, '', $3)`,
+		consts.DeletedUserNickname, consts.DeletedUserFullname, consts.DeletedUserEmail)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// reports counters that drifted from the source rows and,
+// when fix is set, overwrites them in the same transaction
+func (rep ServicePgRepository) Reconcile(fix bool) (*models.Reconciliation, error) {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reconciliation := &models.Reconciliation{
+		Forums:  []*models.ForumDrift{},
+		Threads: []*models.ThreadDrift{},
+	}
+	if err := selectForumDrift(tx, reconciliation); err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return nil, err
+	}
+	if err := selectThreadDrift(tx, reconciliation); err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return nil, err
+	}
+
+	if !fix || (len(reconciliation.Forums) == 0 && len(reconciliation.Threads) == 0) {
+		return reconciliation, tx.Rollback()
+	}
+
+	statements := []string{
+		expectedForumCounters + `
+		UPDATE forums f
+		SET posts = e.posts, threads = e.threads
+		FROM expected e
+		WHERE e.slug = f.slug
+		  AND (f.posts IS DISTINCT FROM e.posts OR f.threads IS DISTINCT FROM e.threads)`,
+		expectedThreadVotes + `
+		UPDATE threads t
+		SET votes = e.votes
+		FROM expected e
+		WHERE e.id = t.id
+		  AND t.votes IS DISTINCT FROM e.votes`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			if err := tx.Rollback(); err != nil {
+				logrus.Error(err)
+			}
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	reconciliation.Fixed = true
+	return reconciliation, nil
+}
+
+func selectForumDrift(tx *sql.Tx, reconciliation *models.Reconciliation) error {
+	rows, err := tx.Query(expectedForumCounters + `
+		SELECT f.slug, coalesce(f.posts, 0), e.posts, coalesce(f.threads, 0), e.threads
+		FROM forums f
+		JOIN expected e on e.slug = f.slug
+		WHERE f.posts IS DISTINCT FROM e.posts
+		   OR f.threads IS DISTINCT FROM e.threads
+		ORDER BY f.slug`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		drift := &models.ForumDrift{}
+		err := rows.Scan(&drift.Slug, &drift.Posts, &drift.ExpectedPosts,
+			&drift.Threads, &drift.ExpectedThreads)
+		if err != nil {
+			return err
+		}
+		reconciliation.Forums = append(reconciliation.Forums, drift)
+	}
+	return rows.Err()
+}
+
+func selectThreadDrift(tx *sql.Tx, reconciliation *models.Reconciliation) error {
+	rows, err := tx.Query(expectedThreadVotes + `
+		SELECT t.id, coalesce(t.votes, 0), e.votes
+		FROM threads t
+		JOIN expected e on e.id = t.id
+		WHERE t.votes IS DISTINCT FROM e.votes
+		ORDER BY t.id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		drift := &models.ThreadDrift{}
+		if err := rows.Scan(&drift.ID, &drift.Votes, &drift.ExpectedVotes); err != nil {
+			return err
+		}
+		reconciliation.Threads = append(reconciliation.Threads, drift)
+	}
+	return rows.Err()
+}
@@ -8,4 +8,5 @@ import (
 type ServiceUseCase interface {
 	Delete() *errors.Error
 	GetStatus() (*models.ServiceStatus, *errors.Error)
+	Reconcile(fix bool, caller *models.User) (*models.Reconciliation, *errors.Error)
 }
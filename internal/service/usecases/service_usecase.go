@@ -1,6 +1,7 @@
 package usecases
 
 import (
+	"github.com/technopark_database/internal/auth"
 	"github.com/technopark_database/internal/consts"
 	"github.com/technopark_database/internal/helpers/errors"
 	"github.com/technopark_database/internal/models"
@@ -8,7 +9,8 @@ import (
 )
 
 type ServiceUseCase struct {
-	rep service.ServiceRepository
+	rep         service.ServiceRepository
+	authUseCase auth.AuthUseCase
 }
 
 func (su *ServiceUseCase) GetStatus() (*models.ServiceStatus, *errors.Error) {
@@ -19,8 +21,8 @@ func (su *ServiceUseCase) GetStatus() (*models.ServiceStatus, *errors.Error) {
 	return serviceStatus, nil
 }
 
-func NewServiceUseCase(rep service.ServiceRepository) service.ServiceUseCase {
-	return &ServiceUseCase{rep: rep}
+func NewServiceUseCase(rep service.ServiceRepository, authUseCase auth.AuthUseCase) service.ServiceUseCase {
+	return &ServiceUseCase{rep: rep, authUseCase: authUseCase}
 }
 
 func (su *ServiceUseCase) Delete() *errors.Error {
@@ -30,3 +32,15 @@ func (su *ServiceUseCase) Delete() *errors.Error {
 	}
 	return nil
 }
+
+func (su *ServiceUseCase) Reconcile(fix bool, caller *models.User) (*models.Reconciliation, *errors.Error) {
+	if customErr := su.authUseCase.CheckAdmin(caller); customErr != nil {
+		return nil, customErr
+	}
+
+	reconciliation, err := su.rep.Reconcile(fix)
+	if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return reconciliation, nil
+}
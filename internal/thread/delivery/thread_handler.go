@@ -3,6 +3,7 @@ package delivery
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/technopark_database/internal/consts"
+	"github.com/technopark_database/internal/helpers/caller"
 	"github.com/technopark_database/internal/helpers/errors"
 	"github.com/technopark_database/internal/models"
 	"github.com/technopark_database/internal/thread"
@@ -17,7 +18,8 @@ type ThreadHandler struct {
 }
 
 type Message struct {
-	Message string `json:"message"`
+	Message string   `json:"message"`
+	Fields  []string `json:"fields,omitempty"`
 }
 
 func NewThreadHandler(threadUseCase thread.ThreadUsecase) *ThreadHandler {
@@ -29,21 +31,33 @@ func (th *ThreadHandler) Configure(e *echo.Echo) {
 	e.GET("/api/thread/:slug_or_id/details", th.GetDetailsHandler())
 	e.POST("/api/thread/:slug_or_id/vote", th.VoteHandler())
 	e.POST("/api/thread/:slug_or_id/details", th.ChangeThreadHandler())
+	e.DELETE("/api/thread/:slug_or_id", th.DeleteThreadHandler())
+	e.POST("/api/thread/:slug_or_id/restore", th.RestoreThreadHandler())
+	e.POST("/api/thread/:slug_or_id/move", th.MoveThreadHandler())
+	e.POST("/api/thread/:slug_or_id/merge", th.MergeThreadHandler())
+	e.POST("/api/thread/:slug_or_id/lock", th.LockThreadHandler(true))
+	e.POST("/api/thread/:slug_or_id/unlock", th.LockThreadHandler(false))
+	e.POST("/api/thread/:slug_or_id/pin", th.PinThreadHandler(true))
+	e.POST("/api/thread/:slug_or_id/unpin", th.PinThreadHandler(false))
+	e.POST("/api/thread/:slug_or_id/announce", th.AnnounceThreadHandler(true))
+	e.POST("/api/thread/:slug_or_id/unannounce", th.AnnounceThreadHandler(false))
+	e.GET("/api/user/:nickname/threads", th.GetUserThreadsHandler())
 }
 
 func (th *ThreadHandler) CreateThreadHandler() echo.HandlerFunc {
 	type Request struct {
-		Title   string    `json:"title"`
-		Author  string    `json:"author"`
-		Message string    `json:"message"`
-		Slug    string    `json:"slug" validate:"omitempty"`
+		Title   string    `json:"title" validate:"required"`
+		Author  string    `json:"author" validate:"required,nickname"`
+		Message string    `json:"message" validate:"required"`
+		Slug    string    `json:"slug" validate:"omitempty,slug"`
 		Created time.Time `json:"created"`
+		Tags    []string  `json:"tags" validate:"dive,slug"`
 	}
 	return func(cntx echo.Context) error {
 		req := &Request{}
 		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
 			//logrus.Error(err.DebugMessage)
-			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
 		}
 
 		forumSlug := cntx.Param("forum_slug")
@@ -55,8 +69,9 @@ func (th *ThreadHandler) CreateThreadHandler() echo.HandlerFunc {
 			Forum:   forumSlug,
 			Slug:    req.Slug,
 			Created: req.Created,
+			Tags:    req.Tags,
 		}
-		createdThread, err := th.threadUseCase.Create(thread)
+		createdThread, err := th.threadUseCase.Create(thread, caller.Get(cntx))
 		if err == errors.Get(consts.CodeThreadAlreadyExist) {
 			//logrus.Error(err.DebugMessage)
 			return cntx.JSON(err.HTTPCode, createdThread)
@@ -80,15 +95,22 @@ func (th *ThreadHandler) GetDetailsHandler() echo.HandlerFunc {
 		id, err := strconv.ParseUint(slugOrID, 10, 64)
 		if err != nil {
 			threadDetails, customErr = th.threadUseCase.GetBySlug(slugOrID)
+			if customErr == errors.Get(consts.CodeThreadDoesNotExist) {
+				mergedID, mergedErr := th.threadUseCase.GetMerged(slugOrID)
+				if mergedErr == nil {
+					return cntx.Redirect(http.StatusMovedPermanently,
+						"/api/thread/"+strconv.FormatUint(mergedID, 10)+"/details")
+				}
+			}
 			if customErr != nil {
 				//logrus.Error(customErr.DebugMessage)
-				return cntx.JSON(customErr.HTTPCode, Message{customErr.UserMessage})
+				return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
 			}
 		} else {
 			threadDetails, customErr = th.threadUseCase.GetByID(id)
 			if customErr != nil {
 				//logrus.Error(customErr.DebugMessage)
-				return cntx.JSON(customErr.HTTPCode, Message{customErr.UserMessage})
+				return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
 			}
 		}
 
@@ -98,15 +120,15 @@ func (th *ThreadHandler) GetDetailsHandler() echo.HandlerFunc {
 
 func (th *ThreadHandler) VoteHandler() echo.HandlerFunc {
 	type Request struct {
-		Nickname string `json:"nickname"`
-		Vote     int    `json:"voice"`
+		Nickname string `json:"nickname" validate:"required,nickname"`
+		Vote     int    `json:"voice" validate:"oneof=-1 1"`
 	}
 
 	return func(cntx echo.Context) error {
 		req := &Request{}
 		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
 			//logrus.Error(err.DebugMessage)
-			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
 		}
 
 		slugOrID := cntx.Param("slug_or_id")
@@ -116,16 +138,16 @@ func (th *ThreadHandler) VoteHandler() echo.HandlerFunc {
 
 		id, err := strconv.ParseUint(slugOrID, 10, 64)
 		if err != nil {
-			threadDetails, customErr = th.threadUseCase.CreateVoteBySlug(slugOrID, req.Nickname, req.Vote)
+			threadDetails, customErr = th.threadUseCase.CreateVoteBySlug(slugOrID, req.Nickname, req.Vote, caller.Get(cntx))
 			if customErr != nil {
 				//logrus.Error(customErr.DebugMessage)
-				return cntx.JSON(customErr.HTTPCode, Message{customErr.UserMessage})
+				return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
 			}
 		} else {
-			threadDetails, customErr = th.threadUseCase.CreateVoteByID(id, req.Nickname, req.Vote)
+			threadDetails, customErr = th.threadUseCase.CreateVoteByID(id, req.Nickname, req.Vote, caller.Get(cntx))
 			if customErr != nil {
 				//logrus.Error(customErr.DebugMessage)
-				return cntx.JSON(customErr.HTTPCode, Message{customErr.UserMessage})
+				return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
 			}
 		}
 
@@ -135,15 +157,16 @@ func (th *ThreadHandler) VoteHandler() echo.HandlerFunc {
 
 func (th *ThreadHandler) ChangeThreadHandler() echo.HandlerFunc {
 	type Request struct {
-		Title   string `json:"title"`
-		Message string `json:"message"`
+		Title   string   `json:"title"`
+		Message string   `json:"message"`
+		Tags    []string `json:"tags" validate:"dive,slug"`
 	}
 
 	return func(cntx echo.Context) error {
 		req := &Request{}
 		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
 			//logrus.Error(err.DebugMessage)
-			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
 		}
 
 		slugOrID := cntx.Param("slug_or_id")
@@ -153,19 +176,217 @@ func (th *ThreadHandler) ChangeThreadHandler() echo.HandlerFunc {
 
 		id, err := strconv.ParseUint(slugOrID, 10, 64)
 		if err != nil {
-			threadDetails, customErr = th.threadUseCase.ChangeBySlug(slugOrID, req.Title, req.Message)
+			threadDetails, customErr = th.threadUseCase.ChangeBySlug(slugOrID, req.Title, req.Message, req.Tags, caller.Get(cntx))
 			if customErr != nil {
 				//logrus.Error(customErr.DebugMessage)
-				return cntx.JSON(customErr.HTTPCode, Message{customErr.UserMessage})
+				return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
 			}
 		} else {
-			threadDetails, customErr = th.threadUseCase.ChangeByID(id, req.Title, req.Message)
+			threadDetails, customErr = th.threadUseCase.ChangeByID(id, req.Title, req.Message, req.Tags, caller.Get(cntx))
 			if customErr != nil {
 				//logrus.Error(customErr.DebugMessage)
-				return cntx.JSON(customErr.HTTPCode, Message{customErr.UserMessage})
+				return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
 			}
 		}
 
 		return cntx.JSON(http.StatusOK, threadDetails)
 	}
 }
+
+func (th *ThreadHandler) DeleteThreadHandler() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slugOrID := cntx.Param("slug_or_id")
+
+		var customErr *errors.Error
+
+		id, err := strconv.ParseUint(slugOrID, 10, 64)
+		if err != nil {
+			customErr = th.threadUseCase.DeleteBySlug(slugOrID, caller.Get(cntx))
+		} else {
+			customErr = th.threadUseCase.DeleteByID(id, caller.Get(cntx))
+		}
+		if customErr != nil {
+			//logrus.Error(customErr.DebugMessage)
+			return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, "")
+	}
+}
+
+func (th *ThreadHandler) RestoreThreadHandler() echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slugOrID := cntx.Param("slug_or_id")
+
+		var threadDetails *models.Thread
+		var customErr *errors.Error
+
+		id, err := strconv.ParseUint(slugOrID, 10, 64)
+		if err != nil {
+			threadDetails, customErr = th.threadUseCase.RestoreBySlug(slugOrID, caller.Get(cntx))
+		} else {
+			threadDetails, customErr = th.threadUseCase.RestoreByID(id, caller.Get(cntx))
+		}
+		if customErr != nil {
+			//logrus.Error(customErr.DebugMessage)
+			return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, threadDetails)
+	}
+}
+
+func (th *ThreadHandler) MoveThreadHandler() echo.HandlerFunc {
+	type Request struct {
+		Forum string `json:"forum" validate:"required"`
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		slugOrID := cntx.Param("slug_or_id")
+
+		var threadDetails *models.Thread
+		var customErr *errors.Error
+
+		id, err := strconv.ParseUint(slugOrID, 10, 64)
+		if err != nil {
+			threadDetails, customErr = th.threadUseCase.MoveBySlug(slugOrID, req.Forum, caller.Get(cntx))
+		} else {
+			threadDetails, customErr = th.threadUseCase.MoveByID(id, req.Forum, caller.Get(cntx))
+		}
+		if customErr != nil {
+			//logrus.Error(customErr.DebugMessage)
+			return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, threadDetails)
+	}
+}
+
+func (th *ThreadHandler) MergeThreadHandler() echo.HandlerFunc {
+	type Request struct {
+		Source string `json:"source" validate:"required"`
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		slugOrID := cntx.Param("slug_or_id")
+
+		var threadDetails *models.Thread
+		var customErr *errors.Error
+
+		id, err := strconv.ParseUint(slugOrID, 10, 64)
+		if err != nil {
+			threadDetails, customErr = th.threadUseCase.MergeBySlug(slugOrID, req.Source, caller.Get(cntx))
+		} else {
+			threadDetails, customErr = th.threadUseCase.MergeByID(id, req.Source, caller.Get(cntx))
+		}
+		if customErr != nil {
+			//logrus.Error(customErr.DebugMessage)
+			return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, threadDetails)
+	}
+}
+
+func (th *ThreadHandler) LockThreadHandler(isLocked bool) echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slugOrID := cntx.Param("slug_or_id")
+
+		var threadDetails *models.Thread
+		var customErr *errors.Error
+
+		id, err := strconv.ParseUint(slugOrID, 10, 64)
+		if err != nil {
+			threadDetails, customErr = th.threadUseCase.SetLockedBySlug(slugOrID, isLocked, caller.Get(cntx))
+		} else {
+			threadDetails, customErr = th.threadUseCase.SetLockedByID(id, isLocked, caller.Get(cntx))
+		}
+		if customErr != nil {
+			//logrus.Error(customErr.DebugMessage)
+			return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, threadDetails)
+	}
+}
+
+func (th *ThreadHandler) PinThreadHandler(isPinned bool) echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slugOrID := cntx.Param("slug_or_id")
+
+		var threadDetails *models.Thread
+		var customErr *errors.Error
+
+		id, err := strconv.ParseUint(slugOrID, 10, 64)
+		if err != nil {
+			threadDetails, customErr = th.threadUseCase.SetPinnedBySlug(slugOrID, isPinned, caller.Get(cntx))
+		} else {
+			threadDetails, customErr = th.threadUseCase.SetPinnedByID(id, isPinned, caller.Get(cntx))
+		}
+		if customErr != nil {
+			//logrus.Error(customErr.DebugMessage)
+			return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, threadDetails)
+	}
+}
+
+func (th *ThreadHandler) AnnounceThreadHandler(isAnnouncement bool) echo.HandlerFunc {
+	return func(cntx echo.Context) error {
+		slugOrID := cntx.Param("slug_or_id")
+
+		var threadDetails *models.Thread
+		var customErr *errors.Error
+
+		id, err := strconv.ParseUint(slugOrID, 10, 64)
+		if err != nil {
+			threadDetails, customErr = th.threadUseCase.SetAnnouncementBySlug(slugOrID, isAnnouncement, caller.Get(cntx))
+		} else {
+			threadDetails, customErr = th.threadUseCase.SetAnnouncementByID(id, isAnnouncement, caller.Get(cntx))
+		}
+		if customErr != nil {
+			//logrus.Error(customErr.DebugMessage)
+			return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, threadDetails)
+	}
+}
+
+func (th *ThreadHandler) GetUserThreadsHandler() echo.HandlerFunc {
+	type Request struct {
+		Since uint64 `query:"since"`
+		models.Pagination
+	}
+
+	return func(cntx echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(cntx).Read(req); err != nil {
+			//logrus.Error(err.DebugMessage)
+			return cntx.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		nickname := cntx.Param("nickname")
+
+		threads, customErr := th.threadUseCase.GetUserThreads(nickname, req.Since, &req.Pagination, caller.Get(cntx))
+		if customErr != nil {
+			//logrus.Error(customErr.DebugMessage)
+			return cntx.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
+		}
+
+		return cntx.JSON(http.StatusOK, threads)
+	}
+}
@@ -1,6 +1,9 @@
 package thread
 
-import "github.com/technopark_database/internal/models"
+import (
+	"github.com/technopark_database/internal/models"
+	"time"
+)
 
 type ThreadRepository interface {
 	Insert(thread *models.Thread) error
@@ -10,4 +13,17 @@ type ThreadRepository interface {
 	SelectBySlug(slug string) (*models.Thread, error)
 	SelectPostsByID(id uint64) ([]*models.Post, error)
 	SelectPostsBySlug(slug string) ([]*models.Post, error)
+	SelectByAuthor(nickname string, since uint64,
+		pagination *models.Pagination, restricted bool, readerID uint64) ([]*models.Thread, error)
+	Delete(id uint64) error
+	Restore(id uint64) error
+	UpdateLocked(id uint64, isLocked bool) error
+	UpdatePinned(id uint64, isPinned bool) error
+	UpdateAnnouncement(id uint64, isAnnouncement bool) error
+	Move(id uint64, forumSlug string) error
+	Merge(targetID uint64, sourceID uint64) error
+	SelectRedirect(oldSlug string) (uint64, error)
+	SelectDeletedByID(id uint64) (*models.Thread, error)
+	SelectDeletedBySlug(slug string) (*models.Thread, error)
+	Purge(before time.Time) (int, error)
 }
@@ -3,8 +3,12 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/technopark_database/internal/helpers/gears"
 	"github.com/technopark_database/internal/models"
 	"github.com/technopark_database/internal/thread"
+	"time"
 )
 
 type ThreadPgRepository struct {
@@ -22,11 +26,11 @@ func (rep *ThreadPgRepository) Insert(thread *models.Thread) error {
 	}
 
 	err = tx.QueryRow(`
-		INSERT INTO threads(title, author, forum, message, votes, slug, created) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO threads(title, author, forum, message, votes, slug, created, tags)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, coalesce($8::text[], '{}'))
 		RETURNING id`,
 		thread.Title, thread.Author, thread.Forum, thread.Message,
-		thread.Votes, thread.Slug, thread.Created).Scan(&thread.ID)
+		thread.Votes, thread.Slug, thread.Created, pq.Array(thread.Tags)).Scan(&thread.ID)
 	if err != nil {
 		_ = tx.Rollback()
 		return err
@@ -50,9 +54,10 @@ func (rep *ThreadPgRepository) UpdateByID(thread *models.Thread) error {
 		SET title=$1,
 		message=$2,
 		slug=$3,
-		votes=$4
+		votes=$4,
+		tags=coalesce($6::text[], '{}')
 		WHERE id=$5`, thread.Title, thread.Message, thread.Slug,
-		thread.Votes, thread.ID)
+		thread.Votes, thread.ID, pq.Array(thread.Tags))
 	if err != nil {
 		_ = tx.Rollback()
 		return err
@@ -74,8 +79,10 @@ func (rep *ThreadPgRepository) UpdateBySlug(thread *models.Thread) error {
 		UPDATE threads
 		SET title=$1,
 		message=$2,
-		votes=$3
-		WHERE slug=$4`, thread.Title, thread.Message, thread.Votes, thread.Slug)
+		votes=$3,
+		tags=coalesce($5::text[], '{}')
+		WHERE slug=$4`, thread.Title, thread.Message, thread.Votes, thread.Slug,
+		pq.Array(thread.Tags))
 	if err != nil {
 		_ = tx.Rollback()
 		return err
@@ -90,10 +97,13 @@ func (rep *ThreadPgRepository) UpdateBySlug(thread *models.Thread) error {
 func (rep *ThreadPgRepository) SelectByID(id uint64) (*models.Thread, error) {
 	thread := &models.Thread{}
 	err := rep.db.QueryRow(`
-		SELECT id, title, author, forum, message, votes, slug, created
+		SELECT id, title, author, forum, message, votes, slug, created, locked,
+		       pinned, announcement, tags
 		FROM threads
-		WHERE id=$1`, id).Scan(&thread.ID, &thread.Title, &thread.Author,
-		&thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created)
+		WHERE id=$1 AND deleted_at IS NULL`, id).Scan(&thread.ID, &thread.Title, &thread.Author,
+		&thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created,
+		&thread.Locked, &thread.Pinned, &thread.Announcement,
+		pq.Array(&thread.Tags))
 	if err != nil {
 		return nil, err
 	}
@@ -103,10 +113,13 @@ func (rep *ThreadPgRepository) SelectByID(id uint64) (*models.Thread, error) {
 func (rep *ThreadPgRepository) SelectBySlug(slug string) (*models.Thread, error) {
 	thread := &models.Thread{}
 	err := rep.db.QueryRow(`
-		SELECT id, title, author, forum, message, votes, slug, created
+		SELECT id, title, author, forum, message, votes, slug, created, locked,
+		       pinned, announcement, tags
 		FROM threads
-		WHERE slug = $1`, slug).Scan(&thread.ID, &thread.Title, &thread.Author,
-		&thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created)
+		WHERE slug = $1 AND deleted_at IS NULL`, slug).Scan(&thread.ID, &thread.Title, &thread.Author,
+		&thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created,
+		&thread.Locked, &thread.Pinned, &thread.Announcement,
+		pq.Array(&thread.Tags))
 	if err != nil {
 		return nil, err
 	}
@@ -169,3 +182,532 @@ func (rep *ThreadPgRepository) SelectPostsBySlug(slug string) ([]*models.Post, e
 	}
 	return posts, nil
 }
+
+// restricted listings only contain forums readable by the reader
+func (rep *ThreadPgRepository) SelectByAuthor(nickname string, since uint64,
+	pagination *models.Pagination, restricted bool, readerID uint64) ([]*models.Thread, error) {
+	query := `
+		SELECT id, title, author, forum, message, votes, slug, created, locked,
+		       pinned, announcement, tags
+		FROM threads
+		WHERE author=$1 AND deleted_at IS NULL`
+	var values []interface{}
+	values = append(values, nickname)
+
+	i := 2
+	if restricted {
+		query, values = gears.AddReadableForum(query, values, "forum", readerID, i)
+		i++
+	}
+
+	query, values = gears.AddKeysetPagination(query, values, "threads", pagination, since, i)
+
+	rows, err := rep.db.Query(query, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var threads []*models.Thread
+	for rows.Next() {
+		thread := &models.Thread{}
+		err := rows.Scan(&thread.ID, &thread.Title, &thread.Author, &thread.Forum,
+			&thread.Message, &thread.Votes, &thread.Slug, &thread.Created,
+			&thread.Locked, &thread.Pinned, &thread.Announcement,
+			pq.Array(&thread.Tags))
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, thread)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return threads, nil
+}
+
+func (rep *ThreadPgRepository) Delete(id uint64) error {
+	return rep.setDeleted(id, true)
+}
+
+func (rep *ThreadPgRepository) Restore(id uint64) error {
+	return rep.setDeleted(id, false)
+}
+
+// soft deletion hides the thread with its posts and takes them off
+// the forum counters, restoring puts them back
+func (rep *ThreadPgRepository) setDeleted(id uint64, isDeleted bool) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	var forumSlug string
+	err = tx.QueryRow(`
+		UPDATE threads
+		SET deleted_at = CASE WHEN $2 THEN now() END
+		WHERE id = $1 AND (deleted_at IS NULL) = $2
+		RETURNING forum`, id, isDeleted).Scan(&forumSlug)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE posts
+		SET deleted = $2
+		WHERE thread = $1`, id, isDeleted)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	posts, err := result.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	sign := int64(1)
+	if isDeleted {
+		sign = -1
+	}
+	_, err = tx.Exec(`
+		UPDATE forums
+		SET threads = threads + $2,
+		    posts   = posts + $3
+		WHERE slug IN (SELECT l.slug FROM forum_lineage($1) l)`,
+		forumSlug, sign, sign*posts)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`SELECT user_stats_shift(ARRAY[$1]::int[], $2)`, id, sign)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`SELECT forum_activity_refresh($1, thread_activity_hours($2))`, forumSlug, id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rep *ThreadPgRepository) UpdateLocked(id uint64, isLocked bool) error {
+	return rep.setFlag(id, "locked", isLocked)
+}
+
+func (rep *ThreadPgRepository) UpdatePinned(id uint64, isPinned bool) error {
+	return rep.setFlag(id, "pinned", isPinned)
+}
+
+func (rep *ThreadPgRepository) UpdateAnnouncement(id uint64, isAnnouncement bool) error {
+	return rep.setFlag(id, "announcement", isAnnouncement)
+}
+
+// column is always one of the constant flag names above
+func (rep *ThreadPgRepository) setFlag(id uint64, column string, value bool) error {
+	result, err := rep.db.Exec(fmt.Sprintf(`
+		UPDATE threads
+		SET %s = $2
+		WHERE id = $1 AND deleted_at IS NULL`, column), id, value)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// moves the thread with its posts, counters of both forum lineages and
+// participants of the target forum are updated in the same transaction
+func (rep *ThreadPgRepository) Move(id uint64, forumSlug string) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	var oldForum string
+	err = tx.QueryRow(`
+		SELECT forum
+		FROM threads
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE`, id).Scan(&oldForum)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE threads
+		SET forum = $2
+		WHERE id = $1`, id, forumSlug)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE posts
+		SET forum = $2
+		WHERE thread = $1`, id, forumSlug)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	posts, err := result.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// shared ancestors get both updates and end up unchanged
+	for _, change := range []struct {
+		slug string
+		sign int64
+	}{{oldForum, -1}, {forumSlug, 1}} {
+		_, err = tx.Exec(`
+			UPDATE forums
+			SET threads = threads + $2,
+			    posts   = posts + $3
+			WHERE slug IN (SELECT l.slug FROM forum_lineage($1) l)`,
+			change.slug, change.sign, change.sign*posts)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_forum(nickname, slug)
+		SELECT author, $2
+		FROM threads
+		WHERE id = $1
+		UNION
+		SELECT author, $2
+		FROM posts
+		WHERE thread = $1
+		ON CONFLICT (nickname, slug) DO UPDATE
+		    SET participant = true
+		    WHERE NOT user_forum.participant`, id, forumSlug)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// the thread takes its posts and votes along, so its hours
+	// are rebuilt in both forums
+	_, err = tx.Exec(`
+		SELECT forum_activity_refresh(f.slug, thread_activity_hours($1))
+		FROM unnest(ARRAY[$2, $3]::citext[]) AS f(slug)`, id, oldForum, forumSlug)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// moves posts and votes of the source thread into the target one and
+// drops the source, its slug keeps leading to the target.
+// source roots are re-parented under the first root of the target,
+// their paths are prefixed with its path to keep the tree sorts in order
+func (rep *ThreadPgRepository) Merge(targetID uint64, sourceID uint64) error {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	var targetForum, targetAuthor string
+	err = tx.QueryRow(`
+		SELECT forum, author
+		FROM threads
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE`, targetID).Scan(&targetForum, &targetAuthor)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	var sourceForum, sourceAuthor, sourceSlug string
+	var sourceHour sql.NullTime
+	err = tx.QueryRow(`
+		SELECT forum, author, slug, date_trunc('hour', created)
+		FROM threads
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE`, sourceID).Scan(&sourceForum, &sourceAuthor, &sourceSlug, &sourceHour)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// the target vote wins when the user voted for both threads,
+	// the delete trigger takes the dropped vote off the source
+	_, err = tx.Exec(`
+		DELETE FROM votes
+		WHERE thread_id = $2
+		  AND user_id IN (SELECT user_id FROM votes WHERE thread_id = $1)`,
+		targetID, sourceID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// the vote trigger only reacts to likes, so the moved voices
+	// are carried over to the target and both authors' karma here
+	var voices int
+	err = tx.QueryRow(`
+		WITH moved AS (
+			UPDATE votes
+			SET thread_id = $1
+			WHERE thread_id = $2
+			RETURNING likes
+		)
+		SELECT coalesce(sum(CASE WHEN likes THEN 1 ELSE -1 END), 0)
+		FROM moved`, targetID, sourceID).Scan(&voices)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if voices != 0 {
+		statements := []struct {
+			query string
+			args  []interface{}
+		}{
+			{`UPDATE threads SET votes = votes + $2 WHERE id = $1`,
+				[]interface{}{targetID, voices}},
+			{`UPDATE user_stats SET karma = karma + $2
+			  WHERE user_id = (SELECT id FROM users WHERE nickname = $1)`,
+				[]interface{}{targetAuthor, voices}},
+			{`UPDATE user_stats SET karma = karma - $2
+			  WHERE user_id = (SELECT id FROM users WHERE nickname = $1)`,
+				[]interface{}{sourceAuthor, voices}},
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement.query, statement.args...); err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	// without target posts the source roots stay roots
+	result, err := tx.Exec(`
+		WITH root AS (
+			SELECT id, path
+			FROM posts
+			WHERE thread = $1 AND parent = 0
+			ORDER BY id
+			LIMIT 1
+		)
+		UPDATE posts
+		SET thread = $1,
+		    forum  = $3,
+		    parent = CASE
+		                 WHEN posts.parent = 0 THEN coalesce((SELECT id FROM root), 0)
+		                 ELSE posts.parent END,
+		    path   = coalesce((SELECT path FROM root), '{}') || posts.path
+		WHERE thread = $2`, targetID, sourceID, targetForum)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	posts, err := result.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	for _, change := range []struct {
+		slug    string
+		threads int64
+		posts   int64
+	}{{sourceForum, -1, -posts}, {targetForum, 0, posts}} {
+		_, err = tx.Exec(`
+			UPDATE forums
+			SET threads = threads + $2,
+			    posts   = posts + $3
+			WHERE slug IN (SELECT l.slug FROM forum_lineage($1) l)`,
+			change.slug, change.threads, change.posts)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_forum(nickname, slug)
+		SELECT DISTINCT author, $2
+		FROM posts
+		WHERE thread = $1
+		ON CONFLICT (nickname, slug) DO UPDATE
+		    SET participant = true
+		    WHERE NOT user_forum.participant`, targetID, targetForum)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE thread_redirects
+		SET thread_id = $1
+		WHERE thread_id = $2`, targetID, sourceID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM threads
+		WHERE id = $1`, sourceID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// the moved posts and votes are in the target hours now,
+	// the dropped source thread is counted off its own hour
+	_, err = tx.Exec(`
+		SELECT forum_activity_refresh(f.slug, array_append(thread_activity_hours($1), $2::timestamptz))
+		FROM (SELECT DISTINCT unnest(ARRAY[$3, $4]::citext[]) AS slug) f`,
+		targetID, sourceHour, sourceForum, targetForum)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if sourceSlug != "" {
+		_, err = tx.Exec(`
+			INSERT INTO thread_redirects(old_slug, thread_id)
+			VALUES ($1, $2)
+			ON CONFLICT (old_slug) DO UPDATE
+			SET thread_id = excluded.thread_id`, sourceSlug, targetID)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rep *ThreadPgRepository) SelectRedirect(oldSlug string) (uint64, error) {
+	var id uint64
+	err := rep.db.QueryRow(`
+		SELECT thread_id
+		FROM thread_redirects
+		WHERE old_slug = $1`, oldSlug).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (rep *ThreadPgRepository) SelectDeletedByID(id uint64) (*models.Thread, error) {
+	thread := &models.Thread{}
+	err := rep.db.QueryRow(`
+		SELECT id, title, author, forum, message, votes, slug, created, locked,
+		       pinned, announcement, tags
+		FROM threads
+		WHERE id=$1 AND deleted_at IS NOT NULL`, id).Scan(&thread.ID, &thread.Title, &thread.Author,
+		&thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created,
+		&thread.Locked, &thread.Pinned, &thread.Announcement,
+		pq.Array(&thread.Tags))
+	if err != nil {
+		return nil, err
+	}
+	return thread, nil
+}
+
+// the slug may have been reused by deleted threads, the latest one wins
+func (rep *ThreadPgRepository) SelectDeletedBySlug(slug string) (*models.Thread, error) {
+	thread := &models.Thread{}
+	err := rep.db.QueryRow(`
+		SELECT id, title, author, forum, message, votes, slug, created, locked,
+		       pinned, announcement, tags
+		FROM threads
+		WHERE slug = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
+		LIMIT 1`, slug).Scan(&thread.ID, &thread.Title, &thread.Author,
+		&thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created,
+		&thread.Locked, &thread.Pinned, &thread.Announcement,
+		pq.Array(&thread.Tags))
+	if err != nil {
+		return nil, err
+	}
+	return thread, nil
+}
+
+// removes threads soft deleted before the given time together with
+// their posts and votes, forum counters were updated on soft deletion
+func (rep *ThreadPgRepository) Purge(before time.Time) (int, error) {
+	tx, err := rep.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT id
+		FROM threads
+		WHERE deleted_at < $1
+		FOR UPDATE`, before)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			_ = tx.Rollback()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	// the delete triggers take the threads off the authors' stats,
+	// soft deletion already did, so they are put back first
+	statements := []string{`
+		SELECT user_stats_shift($1, 1)`, `
+		DELETE FROM votes
+		WHERE thread_id = ANY ($1)`, `
+		DELETE FROM posts
+		WHERE thread = ANY ($1)`, `
+		DELETE FROM threads
+		WHERE id = ANY ($1)`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, pq.Array(ids)); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
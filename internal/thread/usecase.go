@@ -3,15 +3,34 @@ package thread
 import (
 	"github.com/technopark_database/internal/helpers/errors"
 	"github.com/technopark_database/internal/models"
+	"time"
 )
 
 type ThreadUsecase interface {
-	Create(thread *models.Thread) (*models.Thread, *errors.Error)
-	CreateVoteByID(id uint64, nickname string, vote int) (*models.Thread, *errors.Error)
-	CreateVoteBySlug(slug string, nickname string, vote int) (*models.Thread, *errors.Error)
-	ChangeByID(id uint64, title, message string) (*models.Thread, *errors.Error)
-	ChangeBySlug(slug string, title, message string) (*models.Thread, *errors.Error)
+	Create(thread *models.Thread, caller *models.User) (*models.Thread, *errors.Error)
+	CreateVoteByID(id uint64, nickname string, vote int, caller *models.User) (*models.Thread, *errors.Error)
+	CreateVoteBySlug(slug string, nickname string, vote int, caller *models.User) (*models.Thread, *errors.Error)
+	ChangeByID(id uint64, title, message string, tags []string, caller *models.User) (*models.Thread, *errors.Error)
+	ChangeBySlug(slug string, title, message string, tags []string, caller *models.User) (*models.Thread, *errors.Error)
 	GetByID(id uint64) (*models.Thread, *errors.Error)
 	GetBySlug(slug string) (*models.Thread, *errors.Error)
 	GetPostsByID(id uint64) ([]*models.Post, *errors.Error)
+	GetUserThreads(nickname string, since uint64,
+		pagination *models.Pagination, caller *models.User) ([]*models.Thread, *errors.Error)
+	DeleteByID(id uint64, caller *models.User) *errors.Error
+	DeleteBySlug(slug string, caller *models.User) *errors.Error
+	RestoreByID(id uint64, caller *models.User) (*models.Thread, *errors.Error)
+	RestoreBySlug(slug string, caller *models.User) (*models.Thread, *errors.Error)
+	SetLockedByID(id uint64, isLocked bool, caller *models.User) (*models.Thread, *errors.Error)
+	SetLockedBySlug(slug string, isLocked bool, caller *models.User) (*models.Thread, *errors.Error)
+	SetPinnedByID(id uint64, isPinned bool, caller *models.User) (*models.Thread, *errors.Error)
+	SetPinnedBySlug(slug string, isPinned bool, caller *models.User) (*models.Thread, *errors.Error)
+	SetAnnouncementByID(id uint64, isAnnouncement bool, caller *models.User) (*models.Thread, *errors.Error)
+	SetAnnouncementBySlug(slug string, isAnnouncement bool, caller *models.User) (*models.Thread, *errors.Error)
+	MoveByID(id uint64, forumSlug string, caller *models.User) (*models.Thread, *errors.Error)
+	MoveBySlug(slug string, forumSlug string, caller *models.User) (*models.Thread, *errors.Error)
+	MergeByID(id uint64, source string, caller *models.User) (*models.Thread, *errors.Error)
+	MergeBySlug(slug string, source string, caller *models.User) (*models.Thread, *errors.Error)
+	GetMerged(oldSlug string) (uint64, *errors.Error)
+	Purge(retention time.Duration) (int, *errors.Error)
 }
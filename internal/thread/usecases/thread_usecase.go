@@ -2,6 +2,7 @@ package usecases
 
 import (
 	"database/sql"
+	"github.com/technopark_database/internal/auth"
 	"github.com/technopark_database/internal/consts"
 	"github.com/technopark_database/internal/forum"
 	"github.com/technopark_database/internal/helpers/errors"
@@ -9,6 +10,9 @@ import (
 	"github.com/technopark_database/internal/thread"
 	"github.com/technopark_database/internal/user"
 	"github.com/technopark_database/internal/vote"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ThreadUseCase struct {
@@ -16,17 +20,24 @@ type ThreadUseCase struct {
 	userUseCase  user.UserUseCase
 	forumUseCase forum.ForumUseCase
 	voteUseCase  vote.VoteUseCase
+	authUseCase  auth.AuthUseCase
 }
 
 func NewThreadUseCase(rep thread.ThreadRepository, userUseCase user.UserUseCase,
-	forumUseCase forum.ForumUseCase, voteUseCase vote.VoteUseCase) thread.ThreadUsecase {
+	forumUseCase forum.ForumUseCase, voteUseCase vote.VoteUseCase,
+	authUseCase auth.AuthUseCase) thread.ThreadUsecase {
 	return &ThreadUseCase{rep: rep,
 		userUseCase:  userUseCase,
 		forumUseCase: forumUseCase,
-		voteUseCase:  voteUseCase}
+		voteUseCase:  voteUseCase,
+		authUseCase:  authUseCase}
 }
 
-func (th *ThreadUseCase) Create(thread *models.Thread) (*models.Thread, *errors.Error) {
+func (th *ThreadUseCase) Create(thread *models.Thread, caller *models.User) (*models.Thread, *errors.Error) {
+	if customErr := th.authUseCase.CheckActor(caller, thread.Author); customErr != nil {
+		return nil, customErr
+	}
+
 	existedForum, customErr := th.forumUseCase.GetDetails(thread.Forum)
 	if customErr != nil {
 		return nil, customErr
@@ -38,6 +49,12 @@ func (th *ThreadUseCase) Create(thread *models.Thread) (*models.Thread, *errors.
 		return nil, customErr
 	}
 	thread.Author = author.Nickname
+	thread.Tags = normalizeTags(thread.Tags)
+
+	customErr = th.forumUseCase.CheckWritable(thread.Forum, []string{thread.Author})
+	if customErr != nil {
+		return nil, customErr
+	}
 
 	if thread.Slug != "" {
 		existedThread, customErr := th.GetBySlug(thread.Slug)
@@ -66,17 +83,30 @@ func (th *ThreadUseCase) CreateVoteModel(thread *models.Thread,
 	return voteModel
 }
 
-func (th *ThreadUseCase) CreateVoteByID(id uint64, nickname string, vote int) (*models.Thread, *errors.Error) {
+func (th *ThreadUseCase) CreateVoteByID(id uint64, nickname string, vote int,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	if customErr := th.authUseCase.CheckActor(caller, nickname); customErr != nil {
+		return nil, customErr
+	}
+
 	thread, customErr := th.GetByID(id)
 	if customErr != nil {
 		return nil, customErr
 	}
+	if thread.Locked {
+		return nil, errors.Get(consts.CodeThreadLocked)
+	}
 
 	user, customErr := th.userUseCase.GetUserInfo(nickname)
 	if customErr != nil {
 		return nil, customErr
 	}
 
+	customErr = th.forumUseCase.CheckWritable(thread.Forum, []string{user.Nickname})
+	if customErr != nil {
+		return nil, customErr
+	}
+
 	voteModel := th.CreateVoteModel(thread, user, vote)
 	// don't need to update votes field in thread
 	// because there is a trigger in db
@@ -95,17 +125,30 @@ func (th *ThreadUseCase) CreateVoteByID(id uint64, nickname string, vote int) (*
 	return thread, nil
 }
 
-func (th *ThreadUseCase) CreateVoteBySlug(slug string, nickname string, vote int) (*models.Thread, *errors.Error) {
+func (th *ThreadUseCase) CreateVoteBySlug(slug string, nickname string, vote int,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	if customErr := th.authUseCase.CheckActor(caller, nickname); customErr != nil {
+		return nil, customErr
+	}
+
 	thread, customErr := th.GetBySlug(slug)
 	if customErr != nil {
 		return nil, customErr
 	}
+	if thread.Locked {
+		return nil, errors.Get(consts.CodeThreadLocked)
+	}
 
 	user, customErr := th.userUseCase.GetUserInfo(nickname)
 	if customErr != nil {
 		return nil, customErr
 	}
 
+	customErr = th.forumUseCase.CheckWritable(thread.Forum, []string{user.Nickname})
+	if customErr != nil {
+		return nil, customErr
+	}
+
 	voteModel := th.CreateVoteModel(thread, user, vote)
 	// don't need to update votes field in thread
 	// because there is a trigger in db
@@ -128,17 +171,27 @@ func (th *ThreadUseCase) IsForumExist(title string) (bool, *errors.Error) {
 	panic("")
 }
 
-func (th *ThreadUseCase) ChangeByID(id uint64, title, message string) (*models.Thread, *errors.Error) {
+func (th *ThreadUseCase) ChangeByID(id uint64, title, message string, tags []string,
+	caller *models.User) (*models.Thread, *errors.Error) {
 	thread, customErr := th.GetByID(id)
 	if customErr != nil {
 		return nil, customErr
 	}
+	if customErr := th.authUseCase.CheckEditor(caller, thread.Author, thread.Forum); customErr != nil {
+		return nil, customErr
+	}
+	if customErr := th.forumUseCase.CheckWritable(thread.Forum, nil); customErr != nil {
+		return nil, customErr
+	}
 	if title != "" {
 		thread.Title = title
 	}
 	if message != "" {
 		thread.Message = message
 	}
+	if tags != nil {
+		thread.Tags = normalizeTags(tags)
+	}
 
 
 	err := th.rep.UpdateByID(thread)
@@ -148,17 +201,27 @@ func (th *ThreadUseCase) ChangeByID(id uint64, title, message string) (*models.T
 	return thread, nil
 }
 
-func (th *ThreadUseCase) ChangeBySlug(slug string, title, message string) (*models.Thread, *errors.Error) {
+func (th *ThreadUseCase) ChangeBySlug(slug string, title, message string, tags []string,
+	caller *models.User) (*models.Thread, *errors.Error) {
 	thread, customErr := th.GetBySlug(slug)
 	if customErr != nil {
 		return nil, customErr
 	}
+	if customErr := th.authUseCase.CheckEditor(caller, thread.Author, thread.Forum); customErr != nil {
+		return nil, customErr
+	}
+	if customErr := th.forumUseCase.CheckWritable(thread.Forum, nil); customErr != nil {
+		return nil, customErr
+	}
 	if title != "" {
 		thread.Title = title
 	}
 	if message != "" {
 		thread.Message = message
 	}
+	if tags != nil {
+		thread.Tags = normalizeTags(tags)
+	}
 
 	err := th.rep.UpdateBySlug(thread)
 	if err != nil {
@@ -196,3 +259,369 @@ func (th *ThreadUseCase) GetPostsByID(id uint64) ([]*models.Post, *errors.Error)
 	}
 	return posts, nil
 }
+
+func (th *ThreadUseCase) GetUserThreads(nickname string, since uint64,
+	pagination *models.Pagination, caller *models.User) ([]*models.Thread, *errors.Error) {
+	if pagination.Limit == 0 {
+		pagination.Limit = 100
+	}
+
+	author, customErr := th.userUseCase.GetUserInfo(nickname)
+	if customErr != nil {
+		return nil, customErr
+	}
+
+	// in open mode every forum is readable
+	restricted := !th.authUseCase.IsOpen()
+	var readerID uint64
+	if caller != nil {
+		readerID = caller.ID
+	}
+
+	threads, err := th.rep.SelectByAuthor(author.Nickname, since, pagination,
+		restricted, readerID)
+	if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	if threads == nil {
+		return []*models.Thread{}, nil
+	}
+	return threads, nil
+}
+
+func (th *ThreadUseCase) DeleteByID(id uint64, caller *models.User) *errors.Error {
+	thread, customErr := th.GetByID(id)
+	if customErr != nil {
+		return customErr
+	}
+	return th.delete(thread, caller)
+}
+
+func (th *ThreadUseCase) DeleteBySlug(slug string, caller *models.User) *errors.Error {
+	thread, customErr := th.GetBySlug(slug)
+	if customErr != nil {
+		return customErr
+	}
+	return th.delete(thread, caller)
+}
+
+// authors and moderators may delete a thread, it stays restorable until purged
+func (th *ThreadUseCase) delete(thread *models.Thread, caller *models.User) *errors.Error {
+	if customErr := th.authUseCase.CheckEditor(caller, thread.Author, thread.Forum); customErr != nil {
+		return customErr
+	}
+	if customErr := th.forumUseCase.CheckWritable(thread.Forum, nil); customErr != nil {
+		return customErr
+	}
+
+	err := th.rep.Delete(thread.ID)
+	if err == sql.ErrNoRows {
+		return errors.Get(consts.CodeThreadDoesNotExist)
+	} else if err != nil {
+		return errors.New(consts.CodeInternalServerError, err)
+	}
+	return nil
+}
+
+func (th *ThreadUseCase) RestoreByID(id uint64, caller *models.User) (*models.Thread, *errors.Error) {
+	thread, err := th.rep.SelectDeletedByID(id)
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodeThreadDoesNotExist)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return th.restore(thread, caller)
+}
+
+func (th *ThreadUseCase) RestoreBySlug(slug string, caller *models.User) (*models.Thread, *errors.Error) {
+	thread, err := th.rep.SelectDeletedBySlug(slug)
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodeThreadDoesNotExist)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return th.restore(thread, caller)
+}
+
+func (th *ThreadUseCase) restore(thread *models.Thread, caller *models.User) (*models.Thread, *errors.Error) {
+	if customErr := th.authUseCase.CheckModerator(caller, thread.Forum); customErr != nil {
+		return nil, customErr
+	}
+	if customErr := th.forumUseCase.CheckWritable(thread.Forum, nil); customErr != nil {
+		return nil, customErr
+	}
+
+	// the slug could have been taken while the thread was deleted
+	if thread.Slug != "" {
+		existedThread, customErr := th.GetBySlug(thread.Slug)
+		if customErr != nil && customErr != errors.Get(consts.CodeThreadDoesNotExist) {
+			return nil, customErr
+		} else if existedThread != nil {
+			return nil, errors.Get(consts.CodeThreadAlreadyExist)
+		}
+	}
+
+	err := th.rep.Restore(thread.ID)
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodeThreadDoesNotExist)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return th.GetByID(thread.ID)
+}
+
+func (th *ThreadUseCase) SetLockedByID(id uint64, isLocked bool,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	thread, customErr := th.GetByID(id)
+	if customErr != nil {
+		return nil, customErr
+	}
+	return th.setLocked(thread, isLocked, caller)
+}
+
+func (th *ThreadUseCase) SetLockedBySlug(slug string, isLocked bool,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	thread, customErr := th.GetBySlug(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	return th.setLocked(thread, isLocked, caller)
+}
+
+// only moderators can lock a thread, a locked thread still can be read and edited
+func (th *ThreadUseCase) setLocked(thread *models.Thread, isLocked bool,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	if customErr := th.authUseCase.CheckModerator(caller, thread.Forum); customErr != nil {
+		return nil, customErr
+	}
+	if customErr := th.forumUseCase.CheckWritable(thread.Forum, nil); customErr != nil {
+		return nil, customErr
+	}
+
+	err := th.rep.UpdateLocked(thread.ID, isLocked)
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodeThreadDoesNotExist)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	thread.Locked = isLocked
+	return thread, nil
+}
+
+func (th *ThreadUseCase) SetPinnedByID(id uint64, isPinned bool,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	thread, customErr := th.GetByID(id)
+	if customErr != nil {
+		return nil, customErr
+	}
+	return th.setPinned(thread, isPinned, caller)
+}
+
+func (th *ThreadUseCase) SetPinnedBySlug(slug string, isPinned bool,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	thread, customErr := th.GetBySlug(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	return th.setPinned(thread, isPinned, caller)
+}
+
+func (th *ThreadUseCase) setPinned(thread *models.Thread, isPinned bool,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	if customErr := th.authUseCase.CheckModerator(caller, thread.Forum); customErr != nil {
+		return nil, customErr
+	}
+	if customErr := th.forumUseCase.CheckWritable(thread.Forum, nil); customErr != nil {
+		return nil, customErr
+	}
+
+	err := th.rep.UpdatePinned(thread.ID, isPinned)
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodeThreadDoesNotExist)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	thread.Pinned = isPinned
+	return thread, nil
+}
+
+func (th *ThreadUseCase) SetAnnouncementByID(id uint64, isAnnouncement bool,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	thread, customErr := th.GetByID(id)
+	if customErr != nil {
+		return nil, customErr
+	}
+	return th.setAnnouncement(thread, isAnnouncement, caller)
+}
+
+func (th *ThreadUseCase) SetAnnouncementBySlug(slug string, isAnnouncement bool,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	thread, customErr := th.GetBySlug(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	return th.setAnnouncement(thread, isAnnouncement, caller)
+}
+
+// announcements show up in every forum, so only admins can make them
+func (th *ThreadUseCase) setAnnouncement(thread *models.Thread, isAnnouncement bool,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	if customErr := th.authUseCase.CheckAdmin(caller); customErr != nil {
+		return nil, customErr
+	}
+	if customErr := th.forumUseCase.CheckWritable(thread.Forum, nil); customErr != nil {
+		return nil, customErr
+	}
+
+	err := th.rep.UpdateAnnouncement(thread.ID, isAnnouncement)
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodeThreadDoesNotExist)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	thread.Announcement = isAnnouncement
+	return thread, nil
+}
+
+func (th *ThreadUseCase) MoveByID(id uint64, forumSlug string,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	thread, customErr := th.GetByID(id)
+	if customErr != nil {
+		return nil, customErr
+	}
+	return th.move(thread, forumSlug, caller)
+}
+
+func (th *ThreadUseCase) MoveBySlug(slug string, forumSlug string,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	thread, customErr := th.GetBySlug(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	return th.move(thread, forumSlug, caller)
+}
+
+// the caller has to moderate both the source and the target forum
+func (th *ThreadUseCase) move(thread *models.Thread, forumSlug string,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	target, customErr := th.forumUseCase.GetDetails(forumSlug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if target.Slug == thread.Forum {
+		return thread, nil
+	}
+
+	for _, slug := range []string{thread.Forum, target.Slug} {
+		if customErr := th.authUseCase.CheckModerator(caller, slug); customErr != nil {
+			return nil, customErr
+		}
+	}
+	if customErr := th.forumUseCase.CheckWritable(thread.Forum, nil); customErr != nil {
+		return nil, customErr
+	}
+	customErr = th.forumUseCase.CheckWritable(target.Slug, []string{thread.Author})
+	if customErr != nil {
+		return nil, customErr
+	}
+
+	err := th.rep.Move(thread.ID, target.Slug)
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodeThreadDoesNotExist)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	thread.Forum = target.Slug
+	return thread, nil
+}
+
+func (th *ThreadUseCase) MergeByID(id uint64, source string,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	thread, customErr := th.GetByID(id)
+	if customErr != nil {
+		return nil, customErr
+	}
+	return th.merge(thread, source, caller)
+}
+
+func (th *ThreadUseCase) MergeBySlug(slug string, source string,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	thread, customErr := th.GetBySlug(slug)
+	if customErr != nil {
+		return nil, customErr
+	}
+	return th.merge(thread, source, caller)
+}
+
+// the source thread is merged into the target one and removed,
+// the caller has to moderate both forums
+func (th *ThreadUseCase) merge(target *models.Thread, source string,
+	caller *models.User) (*models.Thread, *errors.Error) {
+	sourceThread, customErr := th.getBySlugOrID(source)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if sourceThread.ID == target.ID {
+		return nil, errors.Get(consts.CodeBadRequest)
+	}
+
+	for _, slug := range []string{sourceThread.Forum, target.Forum} {
+		if customErr := th.authUseCase.CheckModerator(caller, slug); customErr != nil {
+			return nil, customErr
+		}
+		if customErr := th.forumUseCase.CheckWritable(slug, nil); customErr != nil {
+			return nil, customErr
+		}
+	}
+
+	err := th.rep.Merge(target.ID, sourceThread.ID)
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodeThreadDoesNotExist)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return th.GetByID(target.ID)
+}
+
+// returns id of the thread the thread known as oldSlug was merged into
+func (th *ThreadUseCase) GetMerged(oldSlug string) (uint64, *errors.Error) {
+	id, err := th.rep.SelectRedirect(oldSlug)
+	if err == sql.ErrNoRows {
+		return 0, errors.Get(consts.CodeThreadDoesNotExist)
+	} else if err != nil {
+		return 0, errors.New(consts.CodeInternalServerError, err)
+	}
+	return id, nil
+}
+
+func (th *ThreadUseCase) getBySlugOrID(slugOrID string) (*models.Thread, *errors.Error) {
+	id, err := strconv.ParseUint(slugOrID, 10, 64)
+	if err != nil {
+		return th.GetBySlug(slugOrID)
+	}
+	return th.GetByID(id)
+}
+
+// removes threads that stayed soft deleted longer than the retention period
+func (th *ThreadUseCase) Purge(retention time.Duration) (int, *errors.Error) {
+	purged, err := th.rep.Purge(time.Now().Add(-retention))
+	if err != nil {
+		return 0, errors.New(consts.CodeInternalServerError, err)
+	}
+	return purged, nil
+}
+
+// tags are compared case-insensitively, so they are stored lowercase
+// and without duplicates
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(tag)
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
@@ -4,11 +4,14 @@ import (
 	"github.com/labstack/echo/v4"
 	//"github.com/sirupsen/logrus"
 	"github.com/technopark_database/internal/consts"
+	"github.com/technopark_database/internal/helpers/caller"
 	"github.com/technopark_database/internal/helpers/errors"
 	"github.com/technopark_database/internal/models"
 	"github.com/technopark_database/internal/user"
 	reader "github.com/technopark_database/tools/requestReader"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 type UserHandler struct {
@@ -23,17 +26,25 @@ func (uh *UserHandler) Configure(e *echo.Echo) {
 	e.POST("/api/user/:nickname/create", uh.CreateProfileHandler())
 	e.GET("/api/user/:nickname/profile", uh.GetProfileHandler())
 	e.POST("/api/user/:nickname/profile", uh.ChangeProfileHandler())
+	e.GET("/api/user/search", uh.SearchHandler())
+	e.POST("/api/user/:nickname/rename", uh.RenameHandler())
+	e.DELETE("/api/user/:nickname", uh.DeleteHandler())
+	e.GET("/api/user/:nickname/stats", uh.GetStatsHandler())
+	e.POST("/api/users/import", uh.ImportHandler())
 }
 
 type Message struct {
-	Message string `json:"message"`
+	Message string   `json:"message"`
+	Fields  []string `json:"fields,omitempty"`
 }
 
 func (uh *UserHandler) CreateProfileHandler() echo.HandlerFunc {
 	type CreateRequest struct {
-		Fullname string `json:"fullname"`
+		Nickname string `json:"-" param:"nickname" validate:"nickname"`
+		Fullname string `json:"fullname" validate:"required"`
 		About    string `json:"about"`
-		Email    string `json:"email"`
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password"`
 	}
 
 	return func(context echo.Context) error {
@@ -42,7 +53,7 @@ func (uh *UserHandler) CreateProfileHandler() echo.HandlerFunc {
 		req := &CreateRequest{}
 		if err := reader.NewRequestReader(context).Read(req); err != nil {
 			//logrus.Info(err.DebugMessage)
-			return context.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+			return context.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
 		}
 
 		newUser := &models.User{
@@ -52,7 +63,7 @@ func (uh *UserHandler) CreateProfileHandler() echo.HandlerFunc {
 			Email:    req.Email,
 		}
 
-		users, err := uh.userUseCase.Create(newUser)
+		users, err := uh.userUseCase.Create(newUser, req.Password)
 		if err == errors.Get(consts.CodeUserEmailConflicts) ||
 			err == errors.Get(consts.CodeUserNicknameConflicts) {
 			return context.JSON(err.HTTPCode, users)
@@ -69,6 +80,13 @@ func (uh *UserHandler) GetProfileHandler() echo.HandlerFunc {
 		nickname := context.Param("nickname")
 
 		dbUser, err := uh.userUseCase.GetUserInfo(nickname)
+		if err == errors.Get(consts.CodeUserDoesNotExist) {
+			newNickname, renamedErr := uh.userUseCase.GetRenamed(nickname)
+			if renamedErr == nil {
+				return context.Redirect(http.StatusMovedPermanently,
+					"/api/user/"+url.PathEscape(newNickname)+"/profile")
+			}
+		}
 		if err != nil {
 			//logrus.Info(err.DebugMessage)
 			return context.JSON(err.HTTPCode, Message{Message: err.UserMessage})
@@ -82,7 +100,7 @@ func (uh *UserHandler) ChangeProfileHandler() echo.HandlerFunc {
 	type ChangeRequest struct {
 		Fullname string `json:"fullname"`
 		About    string `json:"about"`
-		Email    string `json:"email"`
+		Email    string `json:"email" validate:"omitempty,email"`
 	}
 
 	return func(context echo.Context) error {
@@ -91,7 +109,7 @@ func (uh *UserHandler) ChangeProfileHandler() echo.HandlerFunc {
 		req := &ChangeRequest{}
 		if err := reader.NewRequestReader(context).Read(req); err != nil {
 			//logrus.Info(err.DebugMessage)
-			return context.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+			return context.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
 		}
 
 		updateUser := &models.User{
@@ -101,7 +119,55 @@ func (uh *UserHandler) ChangeProfileHandler() echo.HandlerFunc {
 			Email:    req.Email,
 		}
 
-		user, customErr := uh.userUseCase.Change(updateUser)
+		user, customErr := uh.userUseCase.Change(updateUser, caller.Get(context))
+		if customErr != nil {
+			//logrus.Info(customErr.DebugMessage)
+			return context.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
+		}
+
+		return context.JSON(http.StatusOK, user)
+	}
+}
+
+func (uh *UserHandler) SearchHandler() echo.HandlerFunc {
+	type Request struct {
+		Query string `query:"q" validate:"required"`
+		Since string `query:"since"`
+		models.Pagination
+	}
+
+	return func(context echo.Context) error {
+		req := &Request{}
+		if err := reader.NewRequestReader(context).Read(req); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return context.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		users, err := uh.userUseCase.Search(req.Query, req.Since, &req.Pagination)
+		if err != nil {
+			//logrus.Info(err.DebugMessage)
+			return context.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return context.JSON(http.StatusOK, users)
+	}
+}
+
+func (uh *UserHandler) RenameHandler() echo.HandlerFunc {
+	type RenameRequest struct {
+		NewNickname string `json:"nickname" validate:"required,nickname"`
+	}
+
+	return func(context echo.Context) error {
+		nickname := context.Param("nickname")
+
+		req := &RenameRequest{}
+		if err := reader.NewRequestReader(context).Read(req); err != nil {
+			//logrus.Info(err.DebugMessage)
+			return context.JSON(err.HTTPCode, Message{Message: err.UserMessage, Fields: err.Fields})
+		}
+
+		user, customErr := uh.userUseCase.Rename(nickname, req.NewNickname, caller.Get(context))
 		if customErr != nil {
 			//logrus.Info(customErr.DebugMessage)
 			return context.JSON(customErr.HTTPCode, Message{Message: customErr.UserMessage})
@@ -110,3 +176,52 @@ func (uh *UserHandler) ChangeProfileHandler() echo.HandlerFunc {
 		return context.JSON(http.StatusOK, user)
 	}
 }
+
+func (uh *UserHandler) DeleteHandler() echo.HandlerFunc {
+	return func(context echo.Context) error {
+		nickname := context.Param("nickname")
+
+		user, err := uh.userUseCase.Delete(nickname, caller.Get(context))
+		if err != nil {
+			//logrus.Info(err.DebugMessage)
+			return context.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return context.JSON(http.StatusOK, user)
+	}
+}
+
+func (uh *UserHandler) GetStatsHandler() echo.HandlerFunc {
+	return func(context echo.Context) error {
+		nickname := context.Param("nickname")
+
+		stats, err := uh.userUseCase.GetStats(nickname)
+		if err != nil {
+			//logrus.Info(err.DebugMessage)
+			return context.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return context.JSON(http.StatusOK, stats)
+	}
+}
+
+func (uh *UserHandler) ImportHandler() echo.HandlerFunc {
+	return func(context echo.Context) error {
+		body := context.Request().Body
+
+		var importReader user.UserReader
+		if strings.HasPrefix(context.Request().Header.Get(echo.HeaderContentType), "text/csv") {
+			importReader = newCSVUserReader(body)
+		} else {
+			importReader = newNDJSONUserReader(body)
+		}
+
+		report, err := uh.userUseCase.Import(importReader, caller.Get(context))
+		if err != nil {
+			//logrus.Info(err.DebugMessage)
+			return context.JSON(err.HTTPCode, Message{Message: err.UserMessage})
+		}
+
+		return context.JSON(http.StatusCreated, report)
+	}
+}
@@ -0,0 +1,84 @@
+package delivery
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/technopark_database/internal/models"
+	"github.com/technopark_database/internal/user"
+	reader "github.com/technopark_database/tools/requestReader"
+	"io"
+	"strings"
+)
+
+// reads one JSON encoded user per line
+type ndjsonUserReader struct {
+	decoder *json.Decoder
+}
+
+func newNDJSONUserReader(body io.Reader) *ndjsonUserReader {
+	return &ndjsonUserReader{decoder: json.NewDecoder(body)}
+}
+
+func (r *ndjsonUserReader) Read() (*models.User, error) {
+	importedUser := &models.User{}
+	if err := r.decoder.Decode(importedUser); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", user.ErrMalformedImport, err)
+	}
+	return checkImportedUser(importedUser)
+}
+
+// reads nickname,fullname,about,email records,
+// the header line is optional
+type csvUserReader struct {
+	reader *csv.Reader
+	line   int
+}
+
+func newCSVUserReader(body io.Reader) *csvUserReader {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = 4
+	reader.ReuseRecord = true
+	return &csvUserReader{reader: reader}
+}
+
+func (r *csvUserReader) Read() (*models.User, error) {
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", user.ErrMalformedImport, err)
+	}
+
+	r.line++
+	if r.line == 1 && strings.EqualFold(record[0], "nickname") {
+		return r.Read()
+	}
+
+	return checkImportedUser(&models.User{
+		Nickname: record[0],
+		Fullname: record[1],
+		About:    record[2],
+		Email:    record[3],
+	})
+}
+
+// imported users follow the rules of the profile creation
+func checkImportedUser(importedUser *models.User) (*models.User, error) {
+	type ImportedUser struct {
+		Nickname string `json:"nickname" validate:"required,nickname"`
+		Email    string `json:"email" validate:"required,email"`
+	}
+
+	err := reader.Validate(&ImportedUser{
+		Nickname: importedUser.Nickname,
+		Email:    importedUser.Email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s of %q", user.ErrMalformedImport,
+			strings.Join(err.Fields, ", "), importedUser.Nickname)
+	}
+	return importedUser, nil
+}
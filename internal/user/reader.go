@@ -0,0 +1,14 @@
+package user
+
+import (
+	"errors"
+	"github.com/technopark_database/internal/models"
+)
+
+var ErrMalformedImport = errors.New("malformed user in import")
+
+// UserReader yields imported users one by one,
+// io.EOF is returned when the input is over
+type UserReader interface {
+	Read() (*models.User, error)
+}
@@ -1,11 +1,23 @@
 package user
 
-import "github.com/technopark_database/internal/models"
+import (
+	"errors"
+	"github.com/technopark_database/internal/models"
+)
+
+// returned by Rename when another user took the nickname meanwhile
+var ErrNicknameTaken = errors.New("nickname is taken")
 
 type UserRepository interface {
-	Insert(user *models.User) error
+	Insert(user *models.User, passwordHash string) error
 	Select(nickname string) (*models.User, error)
 	SelectCountNicknames(nicknames []string) (int, error)
 	Update(user *models.User) error
 	SelectByEmail(email string) (*models.User, error)
+	Search(query string, limit int, since string, desc bool) ([]*models.User, error)
+	Rename(nickname string, newNickname string) error
+	SelectRedirect(oldNickname string) (string, error)
+	Delete(nickname string) error
+	SelectStats(nickname string) (*models.UserStats, error)
+	Import(reader UserReader) (*models.UserImportReport, error)
 }
@@ -3,10 +3,14 @@ package repository
 import (
 	"context"
 	"database/sql"
+	goerrors "errors"
 	"fmt"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
+	"github.com/technopark_database/internal/consts"
 	"github.com/technopark_database/internal/models"
 	"github.com/technopark_database/internal/user"
+	"io"
 	"strings"
 )
 
@@ -48,7 +52,9 @@ func NewUserPgRepository(db *sql.DB) user.UserRepository {
 	return &UserPgRepository{db: db}
 }
 
-func (ur *UserPgRepository) Insert(user *models.User) error {
+// the user and its credentials are stored together,
+// an empty password hash leaves the user without credentials
+func (ur *UserPgRepository) Insert(user *models.User, passwordHash string) error {
 	tx, err := ur.db.BeginTx(context.Background(), &sql.TxOptions{})
 	if err != nil {
 		return err
@@ -65,6 +71,18 @@ func (ur *UserPgRepository) Insert(user *models.User) error {
 		return err
 	}
 
+	if passwordHash != "" {
+		_, err = tx.Exec(`
+			INSERT INTO credentials(user_id, password)
+			VALUES ($1, $2)`, user.ID, passwordHash)
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				logrus.Error(err)
+			}
+			return err
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		return err
 	}
@@ -123,3 +141,401 @@ func (ur *UserPgRepository) SelectByEmail(email string) (*models.User, error) {
 	}
 	return dbUser, nil
 }
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (ur *UserPgRepository) Search(searchQuery string, limit int,
+	since string, desc bool) ([]*models.User, error) {
+	escaped := likeEscaper.Replace(strings.ToLower(searchQuery))
+
+	// nickname and email are matched by prefix, fullname by substring;
+	// both are served by the trigram indexes from init.sql
+	query := `
+		SELECT id, nickname, fullname, about, email
+		FROM users
+		WHERE (lower(nickname::text) LIKE $1
+		       OR lower(email::text) LIKE $1
+		       OR lower(fullname) LIKE $2)`
+	var values []interface{}
+	values = append(values, escaped+"%", "%"+escaped+"%")
+
+	i := 3
+	if since != "" {
+		if desc {
+			query = strings.Join([]string{query, "AND nickname < $3"}, " ")
+		} else {
+			query = strings.Join([]string{query, "AND nickname > $3"}, " ")
+		}
+		values = append(values, since)
+		i++
+	}
+
+	if desc {
+		query = strings.Join([]string{query, "ORDER BY nickname DESC"}, " ")
+	} else {
+		query = strings.Join([]string{query, "ORDER BY nickname"}, " ")
+	}
+	if limit != 0 {
+		query = strings.Join([]string{query,
+			fmt.Sprintf("LIMIT $%d", i)}, " ")
+		values = append(values, limit)
+	}
+
+	rows, err := ur.db.Query(query, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		err := rows.Scan(&user.ID, &user.Nickname,
+			&user.Fullname, &user.About, &user.Email)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// forums, threads, posts, user_forum and user_redirects reference
+// users(nickname) with ON UPDATE CASCADE, so renaming the user row
+// renames the user everywhere in the same transaction
+func (ur *UserPgRepository) Rename(nickname string, newNickname string) error {
+	tx, err := ur.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET nickname = $2
+		WHERE nickname = $1`, nickname, newNickname)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		// the usecase checks the nickname before, but not in this transaction
+		var pqErr *pq.Error
+		if goerrors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return user.ErrNicknameTaken
+		}
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM user_redirects
+		WHERE old_nickname = $1`, newNickname)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+
+	if !strings.EqualFold(nickname, newNickname) {
+		_, err = tx.Exec(`
+			INSERT INTO user_redirects(old_nickname, nickname)
+			VALUES ($1, $2)
+			ON CONFLICT (old_nickname) DO UPDATE
+			SET nickname = excluded.nickname`, nickname, newNickname)
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				logrus.Error(err)
+			}
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ur *UserPgRepository) SelectRedirect(oldNickname string) (string, error) {
+	var nickname string
+	err := ur.db.QueryRow(`
+		SELECT nickname
+		FROM user_redirects
+		WHERE old_nickname = $1`, oldNickname).Scan(&nickname)
+	if err != nil {
+		return "", err
+	}
+	return nickname, nil
+}
+
+// removes the user with its votes and forum memberships,
+// authored threads, posts and owned forums are handed over
+// to the reserved deleted account
+func (ur *UserPgRepository) Delete(nickname string) error {
+	tx, err := ur.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	statements := []struct {
+		query  string
+		values []interface{}
+	}{
+		// votes_del trigger recalculates threads.votes
+		{`
+		DELETE FROM votes
+		WHERE user_id = (SELECT id FROM users WHERE nickname = $1)`,
+			[]interface{}{nickname}},
+		// counters only follow inserts and deletes,
+		// so handed over content is accounted here
+		{`
+		UPDATE user_stats d
+		SET posts   = d.posts + s.posts,
+		    threads = d.threads + s.threads,
+		    karma   = d.karma + s.karma
+		FROM user_stats s
+		WHERE d.user_id = (SELECT id FROM users WHERE nickname = $2)
+		  AND s.user_id = (SELECT id FROM users WHERE nickname = $1)`,
+			[]interface{}{nickname, consts.DeletedUserNickname}},
+		{`
+		UPDATE threads
+		SET author = $2
+		WHERE author = $1`,
+			[]interface{}{nickname, consts.DeletedUserNickname}},
+		{`
+		UPDATE posts
+		SET author = $2
+		WHERE author = $1`,
+			[]interface{}{nickname, consts.DeletedUserNickname}},
+		{`
+		UPDATE forums
+		SET profile = $2
+		WHERE profile = $1`,
+			[]interface{}{nickname, consts.DeletedUserNickname}},
+		{`
+		DELETE FROM user_forum
+		WHERE nickname = $1`,
+			[]interface{}{nickname}},
+		{`
+		DELETE FROM users
+		WHERE nickname = $1`,
+			[]interface{}{nickname}},
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement.query, statement.values...); err != nil {
+			if err := tx.Rollback(); err != nil {
+				logrus.Error(err)
+			}
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ur *UserPgRepository) SelectStats(nickname string) (*models.UserStats, error) {
+	stats := &models.UserStats{}
+	err := ur.db.QueryRow(`
+		SELECT u.nickname, s.posts, s.threads, s.forums, s.karma
+		FROM users u
+		JOIN user_stats s on s.user_id = u.id
+		WHERE u.nickname = $1`, nickname).Scan(
+		&stats.Nickname, &stats.Posts, &stats.Threads,
+		&stats.Forums, &stats.Karma)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// streams users into a temporary table with COPY and merges
+// every row which conflicts neither by nickname nor by email
+func (ur *UserPgRepository) Import(reader user.UserReader) (*models.UserImportReport, error) {
+	tx, err := ur.db.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := importUsers(tx, reader)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			logrus.Error(err)
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func importUsers(tx *sql.Tx, reader user.UserReader) (*models.UserImportReport, error) {
+	_, err := tx.Exec(`
+		CREATE TEMP TABLE users_import
+		(
+			line     serial,
+			nickname citext COLLATE "POSIX",
+			fullname text,
+			about    text,
+			email    citext,
+			existing bool NOT NULL DEFAULT false,
+			picked   bool NOT NULL DEFAULT false,
+			dropped  bool NOT NULL DEFAULT false
+		) ON COMMIT DROP`)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("users_import",
+		"nickname", "fullname", "about", "email"))
+	if err != nil {
+		return nil, err
+	}
+	for {
+		importedUser, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = stmt.Close()
+			return nil, err
+		}
+
+		_, err = stmt.Exec(importedUser.Nickname, importedUser.Fullname,
+			importedUser.About, importedUser.Email)
+		if err != nil {
+			_ = stmt.Close()
+			return nil, err
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		_ = stmt.Close()
+		return nil, err
+	}
+	if err := stmt.Close(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users_import i
+		SET existing = true
+		WHERE EXISTS(SELECT 1
+		             FROM users u
+		             WHERE u.nickname = i.nickname
+		                OR u.email = i.email)`)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		CREATE INDEX ON users_import (nickname);
+		CREATE INDEX ON users_import (email)`)
+	if err != nil {
+		return nil, err
+	}
+
+	// a row is imported when no earlier imported row shares its nickname
+	// or email, rows clashing only with dropped ones still get their turn.
+	// Each round picks the rows no undecided earlier row competes with
+	// and drops the ones clashing with them, the first undecided row
+	// is always picked, so the rounds end
+	for {
+		result, err := tx.Exec(`
+			UPDATE users_import i
+			SET picked = true
+			WHERE NOT i.existing AND NOT i.picked AND NOT i.dropped
+			  AND NOT EXISTS(SELECT 1
+			                 FROM users_import e
+			                 WHERE NOT e.existing AND NOT e.dropped
+			                   AND e.line < i.line
+			                   AND (e.nickname = i.nickname OR e.email = i.email))`)
+		if err != nil {
+			return nil, err
+		}
+		picked, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if picked == 0 {
+			break
+		}
+
+		_, err = tx.Exec(`
+			UPDATE users_import i
+			SET dropped = true
+			WHERE NOT i.existing AND NOT i.picked AND NOT i.dropped
+			  AND EXISTS(SELECT 1
+			             FROM users_import p
+			             WHERE p.picked
+			               AND (p.nickname = i.nickname OR p.email = i.email))`)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	conflicts, err := scanUsers(tx.Query(`
+		SELECT DISTINCT u.id, u.nickname, u.fullname, u.about, u.email
+		FROM users u
+		JOIN users_import i on u.nickname = i.nickname OR u.email = i.email
+		WHERE i.existing
+		ORDER BY u.nickname`))
+	if err != nil {
+		return nil, err
+	}
+
+	// rows which clash with an imported row of the same import
+	duplicates, err := scanUsers(tx.Query(`
+		SELECT 0, nickname, fullname, about, email
+		FROM users_import
+		WHERE dropped
+		ORDER BY line`))
+	if err != nil {
+		return nil, err
+	}
+	conflicts = append(conflicts, duplicates...)
+
+	created, err := scanUsers(tx.Query(`
+		INSERT INTO users(nickname, fullname, about, email)
+		SELECT nickname, fullname, about, email
+		FROM users_import
+		WHERE picked
+		ORDER BY nickname
+		RETURNING id, nickname, fullname, about, email`))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserImportReport{
+		Created:   created,
+		Conflicts: conflicts,
+	}, nil
+}
+
+func scanUsers(rows *sql.Rows, err error) ([]*models.User, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		err := rows.Scan(&user.ID, &user.Nickname,
+			&user.Fullname, &user.About, &user.Email)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"github.com/technopark_database/internal/models"
+	"github.com/technopark_database/internal/user"
+	"github.com/technopark_database/tools/pgtest"
+	"io"
+	"testing"
+)
+
+// the usecase check passed, but somebody took the nickname before the update
+func TestRenameToTakenNickname(t *testing.T) {
+	db := pgtest.Open(t)
+	pgtest.Exec(t, db, `
+		INSERT INTO users(nickname, fullname, about, email)
+		VALUES ('alice', 'Alice', '', 'alice@example.com'),
+		       ('bob', 'Bob', '', 'bob@example.com')`)
+
+	err := NewUserPgRepository(db).Rename("alice", "bob")
+	if err != user.ErrNicknameTaken {
+		t.Fatalf("got %v, want %v", err, user.ErrNicknameTaken)
+	}
+}
+
+type userSlice []*models.User
+
+func (users *userSlice) Read() (*models.User, error) {
+	if len(*users) == 0 {
+		return nil, io.EOF
+	}
+	imported := (*users)[0]
+	*users = (*users)[1:]
+	return imported, nil
+}
+
+// the third row clashes only with the second one, which is dropped
+// because of the first one, so the third row is imported
+func TestImportDuplicatesAgainstImportedRows(t *testing.T) {
+	db := pgtest.Open(t)
+
+	users := &userSlice{
+		{Nickname: "x", Fullname: "X", Email: "p@example.com"},
+		{Nickname: "y", Fullname: "Y", Email: "p@example.com"},
+		{Nickname: "y", Fullname: "Z", Email: "q@example.com"},
+	}
+	report, err := NewUserPgRepository(db).Import(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := map[string]string{}
+	for _, createdUser := range report.Created {
+		created[createdUser.Nickname] = createdUser.Fullname
+	}
+	if len(created) != 2 || created["x"] != "X" || created["y"] != "Z" {
+		t.Errorf("created %v, want x as X and y as Z", created)
+	}
+	if len(report.Conflicts) != 1 || report.Conflicts[0].Fullname != "Y" {
+		t.Errorf("conflicts are %v, want the second row only", report.Conflicts)
+	}
+}
@@ -6,9 +6,15 @@ import (
 )
 
 type UserUseCase interface {
-	Create(user *models.User) ([]*models.User, *errors.Error)
-	Change(user *models.User) (*models.User, *errors.Error)
+	Create(user *models.User, password string) ([]*models.User, *errors.Error)
+	Change(user *models.User, caller *models.User) (*models.User, *errors.Error)
 	GetUserInfo(nickname string) (*models.User, *errors.Error)
 	IsExist(nickname string) (bool, *errors.Error)
 	CheckNicknames(nickname []string) *errors.Error
+	Search(query string, since string, pagination *models.Pagination) ([]*models.User, *errors.Error)
+	Rename(nickname string, newNickname string, caller *models.User) (*models.User, *errors.Error)
+	GetRenamed(oldNickname string) (string, *errors.Error)
+	Delete(nickname string, caller *models.User) (*models.User, *errors.Error)
+	GetStats(nickname string) (*models.UserStats, *errors.Error)
+	Import(reader UserReader, caller *models.User) (*models.UserImportReport, *errors.Error)
 }
@@ -2,14 +2,19 @@ package usecases
 
 import (
 	"database/sql"
+	goerrors "errors"
+	"fmt"
+	"github.com/technopark_database/internal/auth"
 	"github.com/technopark_database/internal/consts"
 	"github.com/technopark_database/internal/helpers/errors"
 	"github.com/technopark_database/internal/models"
 	"github.com/technopark_database/internal/user"
+	"strings"
 )
 
 type UserUseCase struct {
-	rep user.UserRepository
+	rep         user.UserRepository
+	authUseCase auth.AuthUseCase
 }
 
 func (uc *UserUseCase) IsExist(nickname string) (bool, *errors.Error) {
@@ -22,11 +27,15 @@ func (uc *UserUseCase) IsExist(nickname string) (bool, *errors.Error) {
 	return true, nil
 }
 
-func NewUserUseCase(repository user.UserRepository) user.UserUseCase {
-	return &UserUseCase{rep: repository}
+func NewUserUseCase(repository user.UserRepository, authUseCase auth.AuthUseCase) user.UserUseCase {
+	return &UserUseCase{rep: repository, authUseCase: authUseCase}
 }
 
-func (uc *UserUseCase) Create(user *models.User) ([]*models.User, *errors.Error) {
+func (uc *UserUseCase) Create(user *models.User, password string) ([]*models.User, *errors.Error) {
+	if fields := reservedFields(user); fields != nil {
+		return nil, errors.NewFieldsError(fields)
+	}
+
 	nicknameUserConflict, customErr := uc.isNicknameExist(user.Nickname)
 	if customErr != nil {
 		return nil, customErr
@@ -53,7 +62,15 @@ func (uc *UserUseCase) Create(user *models.User) ([]*models.User, *errors.Error)
 		return conflictedUsers, errors.Get(consts.CodeUserEmailConflicts)
 	}
 
-	err := uc.rep.Insert(user)
+	var passwordHash string
+	if password != "" {
+		passwordHash, customErr = uc.authUseCase.HashPassword(password)
+		if customErr != nil {
+			return nil, customErr
+		}
+	}
+
+	err := uc.rep.Insert(user, passwordHash)
 	if err != nil {
 		return nil, errors.New(consts.CodeInternalServerError, err)
 	}
@@ -85,7 +102,11 @@ func (uc *UserUseCase) IsEmailAlreadyExist(email string) (*models.User, *errors.
 	return dbUser, nil
 }
 
-func (uc *UserUseCase) Change(user *models.User) (*models.User, *errors.Error) {
+func (uc *UserUseCase) Change(user *models.User, caller *models.User) (*models.User, *errors.Error) {
+	if customErr := uc.authUseCase.CheckOwner(caller, user.Nickname); customErr != nil {
+		return nil, customErr
+	}
+
 	dbUser, customErr := uc.GetUserInfo(user.Nickname)
 	if customErr != nil {
 		return nil, customErr
@@ -153,3 +174,143 @@ func (uc *UserUseCase) CheckNicknames(nicknames []string) *errors.Error {
 
 	return nil
 }
+
+func (uc *UserUseCase) Search(query string, since string,
+	pagination *models.Pagination) ([]*models.User, *errors.Error) {
+	if query == "" {
+		return nil, errors.Get(consts.CodeBadRequest)
+	}
+	if pagination.Limit == 0 {
+		pagination.Limit = 100
+	}
+
+	users, err := uc.rep.Search(query, pagination.Limit, since, pagination.Desc)
+	if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return users, nil
+}
+
+func (uc *UserUseCase) Rename(nickname string, newNickname string,
+	caller *models.User) (*models.User, *errors.Error) {
+	if customErr := uc.authUseCase.CheckOwner(caller, nickname); customErr != nil {
+		return nil, customErr
+	}
+
+	dbUser, customErr := uc.GetUserInfo(nickname)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if newNickname == "" || strings.EqualFold(newNickname, consts.DeletedUserNickname) {
+		return nil, errors.Get(consts.CodeBadRequest)
+	}
+
+	if !strings.EqualFold(dbUser.Nickname, newNickname) {
+		conflictUser, customErr := uc.isNicknameExist(newNickname)
+		if customErr != nil {
+			return nil, customErr
+		}
+		if conflictUser != nil {
+			return conflictUser, errors.Get(consts.CodeUserNicknameConflicts)
+		}
+	}
+
+	err := uc.rep.Rename(dbUser.Nickname, newNickname)
+	if err == user.ErrNicknameTaken {
+		// a concurrent rename or registration won the race
+		conflictUser, customErr := uc.isNicknameExist(newNickname)
+		if customErr != nil {
+			return nil, customErr
+		}
+		return conflictUser, errors.Get(consts.CodeUserNicknameConflicts)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	dbUser.Nickname = newNickname
+	return dbUser, nil
+}
+
+// returns current nickname of the user
+// who was previously known as oldNickname
+func (uc *UserUseCase) GetRenamed(oldNickname string) (string, *errors.Error) {
+	nickname, err := uc.rep.SelectRedirect(oldNickname)
+	if err == sql.ErrNoRows {
+		return "", errors.Get(consts.CodeUserDoesNotExist)
+	} else if err != nil {
+		return "", errors.New(consts.CodeInternalServerError, err)
+	}
+	return nickname, nil
+}
+
+func (uc *UserUseCase) Delete(nickname string, caller *models.User) (*models.User, *errors.Error) {
+	if customErr := uc.authUseCase.CheckOwner(caller, nickname); customErr != nil {
+		return nil, customErr
+	}
+	if strings.EqualFold(nickname, consts.DeletedUserNickname) {
+		return nil, errors.Get(consts.CodeBadRequest)
+	}
+
+	dbUser, customErr := uc.GetUserInfo(nickname)
+	if customErr != nil {
+		return nil, customErr
+	}
+
+	if err := uc.rep.Delete(dbUser.Nickname); err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return dbUser, nil
+}
+
+func (uc *UserUseCase) GetStats(nickname string) (*models.UserStats, *errors.Error) {
+	stats, err := uc.rep.SelectStats(nickname)
+	if err == sql.ErrNoRows {
+		return nil, errors.Get(consts.CodeUserDoesNotExist)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return stats, nil
+}
+
+func (uc *UserUseCase) Import(reader user.UserReader,
+	caller *models.User) (*models.UserImportReport, *errors.Error) {
+	if customErr := uc.authUseCase.CheckAdmin(caller); customErr != nil {
+		return nil, customErr
+	}
+
+	report, err := uc.rep.Import(&reservedCheckingReader{reader: reader})
+	if goerrors.Is(err, user.ErrMalformedImport) {
+		return nil, errors.New(consts.CodeBadRequest, err)
+	} else if err != nil {
+		return nil, errors.New(consts.CodeInternalServerError, err)
+	}
+	return report, nil
+}
+
+// names the fields of the user which belong to the reserved account
+func reservedFields(user *models.User) []string {
+	var fields []string
+	if strings.EqualFold(user.Nickname, consts.DeletedUserNickname) {
+		fields = append(fields, "nickname")
+	}
+	if strings.EqualFold(user.Email, consts.DeletedUserEmail) {
+		fields = append(fields, "email")
+	}
+	return fields
+}
+
+// fails the import on users which would take over the reserved account
+type reservedCheckingReader struct {
+	reader user.UserReader
+}
+
+func (r *reservedCheckingReader) Read() (*models.User, error) {
+	importedUser, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if fields := reservedFields(importedUser); fields != nil {
+		return nil, fmt.Errorf("%w: %s of %s is reserved", user.ErrMalformedImport,
+			strings.Join(fields, " and "), importedUser.Nickname)
+	}
+	return importedUser, nil
+}
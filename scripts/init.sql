@@ -1,5 +1,6 @@
 CREATE EXTENSION IF NOT EXISTS citext;
-DROP TABLE IF EXISTS users, forums, posts, threads, votes, user_forum CASCADE;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+DROP TABLE IF EXISTS users, user_redirects, user_stats, credentials, sessions, forums, posts, threads, votes, user_forum, roles, bans, forum_activity, forum_activity_users, thread_redirects CASCADE;
 
 CREATE UNLOGGED TABLE IF NOT EXISTS users
 (
@@ -13,6 +14,51 @@ CREATE UNLOGGED TABLE IF NOT EXISTS users
 CREATE INDEX users_cover ON users (nickname, fullname, about, email);
 CREATE INDEX users_nickname ON users using hash (nickname);
 CREATE INDEX users_email ON users using hash (email);
+CREATE INDEX users_nickname_trgm ON users USING gin (lower(nickname::text) gin_trgm_ops);
+CREATE INDEX users_fullname_trgm ON users USING gin (lower(fullname) gin_trgm_ops);
+CREATE INDEX users_email_trgm ON users USING gin (lower(email::text) gin_trgm_ops);
+
+-- Old nicknames of renamed users
+CREATE UNLOGGED TABLE IF NOT EXISTS user_redirects
+(
+    old_nickname citext COLLATE "POSIX" PRIMARY KEY,
+    nickname     citext NOT NULL,
+
+    FOREIGN KEY (nickname) REFERENCES users (nickname) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX user_redirects_nickname ON user_redirects (nickname);
+
+-- Counters maintained by triggers, keyed by id so that renames don't touch them
+CREATE UNLOGGED TABLE IF NOT EXISTS user_stats
+(
+    user_id int PRIMARY KEY,
+    posts   int NOT NULL DEFAULT 0,
+    threads int NOT NULL DEFAULT 0,
+    forums  int NOT NULL DEFAULT 0,
+    karma   int NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE UNLOGGED TABLE IF NOT EXISTS credentials
+(
+    user_id  int PRIMARY KEY,
+    password text NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Login sessions expire, api tokens have no expiration
+CREATE UNLOGGED TABLE IF NOT EXISTS sessions
+(
+    token   text PRIMARY KEY,
+    user_id int         NOT NULL,
+    created timestamptz NOT NULL DEFAULT now(),
+    expires timestamptz,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX sessions_user ON sessions (user_id);
 
 CREATE UNLOGGED TABLE IF NOT EXISTS forums
 (
@@ -20,14 +66,29 @@ CREATE UNLOGGED TABLE IF NOT EXISTS forums
     title   text          NOT NULL,
     profile citext        NOT NULL,
     slug    citext UNIQUE NOT NULL,
-    posts   int DEFAULT 0,
-    threads int DEFAULT 0,
+    posts    int DEFAULT 0,
+    threads  int DEFAULT 0,
+    -- archived forums are read-only and hidden from listings
+    archived bool NOT NULL DEFAULT false,
+    created  timestamptz NOT NULL DEFAULT now(),
+    -- categories and top level forums have no parent
+    parent     citext,
+    -- private forums hide their content from non-members,
+    -- hidden ones aren't listed or shown to them at all
+    visibility text        NOT NULL DEFAULT 'public',
 
-    FOREIGN KEY (profile) REFERENCES users (nickname)
+    FOREIGN KEY (profile) REFERENCES users (nickname) ON UPDATE CASCADE,
+    FOREIGN KEY (parent) REFERENCES forums (slug) ON UPDATE CASCADE,
+    CHECK (visibility IN ('public', 'private', 'hidden'))
 );
 CREATE INDEX forums_cover ON forums (title, profile, slug, posts, threads);
 CREATE INDEX forums_slug ON forums USING hash (slug);
 CREATE INDEX forums_user ON forums (profile);
+CREATE INDEX forums_parent ON forums (parent, slug);
+-- keyset pagination of the forum directory, slug breaks ties
+CREATE INDEX forums_directory_created ON forums (created, slug) WHERE NOT archived;
+CREATE INDEX forums_directory_posts ON forums (posts, slug) WHERE NOT archived;
+CREATE INDEX forums_directory_threads ON forums (threads, slug) WHERE NOT archived;
 
 CREATE UNLOGGED TABLE IF NOT EXISTS threads
 (
@@ -39,8 +100,17 @@ CREATE UNLOGGED TABLE IF NOT EXISTS threads
     votes   int,
     slug    citext,
     created timestamptz,
+    -- locked threads accept neither new posts nor votes
+    locked  bool   NOT NULL DEFAULT false,
+    -- pinned threads go first in their forum, announcements in every forum
+    pinned       bool NOT NULL DEFAULT false,
+    announcement bool NOT NULL DEFAULT false,
+    -- lowercase, filtered through threads_tags
+    tags    text[] NOT NULL DEFAULT '{}',
+    -- soft deleted threads are hidden until restored or purged
+    deleted_at timestamptz,
 
-    FOREIGN KEY (author) REFERENCES users (nickname),
+    FOREIGN KEY (author) REFERENCES users (nickname) ON UPDATE CASCADE,
     FOREIGN KEY (forum) REFERENCES forums (slug)
 );
 CREATE INDEX threads_cover ON threads (title, author, forum, message, votes, slug, created);
@@ -49,12 +119,28 @@ CREATE INDEX threads_created ON threads (created);
 CREATE INDEX threads_slug ON threads using hash (slug);
 CREATE INDEX threads_author ON threads (author);
 CREATE INDEX threads_forum ON threads (forum);
+CREATE INDEX threads_author_created ON threads (author, created);
+CREATE INDEX threads_deleted_at ON threads (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX threads_pinned ON threads (forum, created) WHERE pinned OR announcement;
+CREATE INDEX threads_tags ON threads USING gin (tags);
+
+-- Slugs of threads merged into other threads
+CREATE UNLOGGED TABLE IF NOT EXISTS thread_redirects
+(
+    old_slug  citext PRIMARY KEY,
+    thread_id int    NOT NULL,
+
+    FOREIGN KEY (thread_id) REFERENCES threads (id) ON DELETE CASCADE
+);
+CREATE INDEX thread_redirects_thread_id ON thread_redirects (thread_id);
 
 CREATE UNLOGGED TABLE IF NOT EXISTS votes
 (
     thread_id int  NOT NULL,
     user_id   int  NOT NULL,
     likes     bool NOT NULL,
+    -- buckets the vote in forum_activity
+    created   timestamptz NOT NULL DEFAULT now(),
 
     PRIMARY KEY (thread_id, user_id),
     FOREIGN KEY (thread_id) REFERENCES threads (id),
@@ -67,12 +153,14 @@ CREATE UNLOGGED TABLE IF NOT EXISTS posts
     id       serial PRIMARY KEY,
     parent   int    NOT NULL,
     path     int[]  NOT NULL,
-    author   citext NOT NULL REFERENCES users (nickname),
+    author   citext NOT NULL REFERENCES users (nickname) ON UPDATE CASCADE,
     message  text   NOT NULL,
     isEdited bool   NOT NULL DEFAULT false,
     forum    citext REFERENCES forums (slug),
     thread   int REFERENCES threads (id),
-    created  timestamptz
+    created  timestamptz,
+    -- follows the soft deletion of the thread
+    deleted  bool   NOT NULL DEFAULT false
 );
 CREATE INDEX posts_thread_id on posts (thread, created, id);
 -- CREATE INDEX posts_path on posts (path);
@@ -81,26 +169,88 @@ CREATE INDEX posts_path1_path on posts ((path[1]), path);
 -- CREATE INDEX IF NOT EXISTS posts_cover
 --      ON posts (id, parent, path, author, message, isEdited, forum, thread, created);
 CREATE INDEX posts_thread ON posts (thread, parent, path);
+CREATE INDEX posts_author_created_id ON posts (author, created, id);
 -- CREATE INDEX posts_forum ON posts (forum);
 
 
+-- Participants are added by the user_forum_ins trigger once they post,
+-- members are added explicitly and may read non-public forums
 CREATE UNLOGGED TABLE IF NOT EXISTS user_forum
 (
-    nickname citext,
-    slug     citext,
+    nickname    citext,
+    slug        citext,
+    participant bool NOT NULL DEFAULT true,
+    member      bool NOT NULL DEFAULT false,
 
     PRIMARY KEY (nickname, slug),
-    FOREIGN KEY (nickname) REFERENCES users (nickname),
+    FOREIGN KEY (nickname) REFERENCES users (nickname) ON UPDATE CASCADE,
     FOREIGN KEY (slug) REFERENCES forums (slug)
 );
 CREATE INDEX user_forum_nickname ON user_forum (nickname);
 CREATE INDEX user_forum_slug ON user_forum (slug);
 CREATE INDEX user_forum_nickname_slug ON user_forum (nickname, slug);
 
+-- Global admins have no forum, moderators are granted per forum,
+-- users without a role are plain members
+CREATE UNLOGGED TABLE IF NOT EXISTS roles
+(
+    user_id int  NOT NULL,
+    role    text NOT NULL,
+    forum   citext,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (forum) REFERENCES forums (slug) ON DELETE CASCADE,
+    CHECK (role IN ('admin', 'moderator')),
+    CHECK ((role = 'admin') = (forum IS NULL))
+);
+CREATE UNIQUE INDEX roles_user_role_forum ON roles (user_id, role, coalesce(forum, ''));
+CREATE INDEX roles_forum_role ON roles (forum, role);
+
+-- Banned users can't post or vote in the forum until the ban expires
+CREATE UNLOGGED TABLE IF NOT EXISTS bans
+(
+    nickname citext      NOT NULL,
+    forum    citext      NOT NULL,
+    reason   text        NOT NULL DEFAULT '',
+    expires  timestamptz,
+    created  timestamptz NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (forum, nickname),
+    FOREIGN KEY (nickname) REFERENCES users (nickname) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (forum) REFERENCES forums (slug) ON DELETE CASCADE
+);
+
+-- Hourly forum activity, coarser buckets are summed up from these rows
+CREATE UNLOGGED TABLE IF NOT EXISTS forum_activity
+(
+    forum   citext      NOT NULL,
+    hour    timestamptz NOT NULL,
+    posts   int         NOT NULL DEFAULT 0,
+    threads int         NOT NULL DEFAULT 0,
+    votes   int         NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (forum, hour),
+    FOREIGN KEY (forum) REFERENCES forums (slug) ON DELETE CASCADE
+);
+
+-- Users active in the forum per hour, kept apart from the counters
+-- because distinct users can't be summed across hours
+CREATE UNLOGGED TABLE IF NOT EXISTS forum_activity_users
+(
+    forum    citext      NOT NULL,
+    hour     timestamptz NOT NULL,
+    nickname citext      NOT NULL,
+
+    PRIMARY KEY (forum, hour, nickname),
+    FOREIGN KEY (forum) REFERENCES forums (slug) ON DELETE CASCADE,
+    FOREIGN KEY (nickname) REFERENCES users (nickname) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
 CREATE OR REPLACE FUNCTION votes_ins_upd() RETURNS trigger AS
 $$
 DECLARE
-    value int;
+    value         int;
+    thread_author citext;
 BEGIN
     IF TG_OP = 'UPDATE' THEN
         value := 2;
@@ -108,16 +258,19 @@ BEGIN
         value := 1;
     END IF;
 
-    IF NEW.likes = TRUE THEN
-        UPDATE threads
-        SET votes = votes + value
-        WHERE id = NEW.thread_id;
-    ELSE
-        UPDATE threads
-        SET votes = votes - value
-        WHERE id = NEW.thread_id;
+    IF NEW.likes = FALSE THEN
+        value := -value;
     END IF;
 
+    UPDATE threads
+    SET votes = votes + value
+    WHERE id = NEW.thread_id
+    RETURNING author INTO thread_author;
+
+    UPDATE user_stats
+    SET karma = karma + value
+    WHERE user_id = (SELECT id FROM users WHERE nickname = thread_author);
+
     RETURN NEW;
 END;
 $$ LANGUAGE plpgsql;
@@ -125,7 +278,9 @@ $$ LANGUAGE plpgsql;
 CREATE OR REPLACE FUNCTION votes_del() RETURNS trigger AS
 $$
 DECLARE
-    var_likes boolean;
+    var_likes     boolean;
+    value         int;
+    thread_author citext;
 BEGIN
     SELECT likes
     FROM votes
@@ -134,20 +289,26 @@ BEGIN
     INTO STRICT var_likes;
 
     IF var_likes = TRUE THEN
-        UPDATE threads
-        SET votes = votes - 1
-        WHERE id = OLD.thread_id;
+        value := -1;
     ELSE
-        UPDATE threads
-        SET votes = votes + 1
-        WHERE id = OLD.thread_Id;
+        value := 1;
     END IF;
+
+    UPDATE threads
+    SET votes = votes + value
+    WHERE id = OLD.thread_id
+    RETURNING author INTO thread_author;
+
+    UPDATE user_stats
+    SET karma = karma + value
+    WHERE user_id = (SELECT id FROM users WHERE nickname = thread_author);
     RETURN OLD;
 END;
 $$ LANGUAGE plpgsql;
 
+-- thread merges move votes without firing it and fix the counters themselves
 CREATE TRIGGER votes_ins_upd
-    AFTER INSERT OR UPDATE
+    AFTER INSERT OR UPDATE OF likes
     ON votes
     FOR EACH ROW
 EXECUTE PROCEDURE votes_ins_upd();
@@ -192,7 +353,9 @@ $ins_author$
 BEGIN
     INSERT INTO user_forum(nickname, slug)
     VALUES (NEW.author, NEW.forum)
-    ON CONFLICT DO NOTHING;
+    ON CONFLICT (nickname, slug) DO UPDATE
+        SET participant = true
+        WHERE NOT user_forum.participant;
     RETURN NEW;
 END;
 $ins_author$
@@ -227,12 +390,35 @@ EXECUTE PROCEDURE user_forum_ins();
 --     FOR EACH ROW
 -- EXECUTE PROCEDURE posts_inc();
 
+-- The forum itself with depth 0 followed by its ancestors up to the category,
+-- forum counters roll up along this chain
+CREATE OR REPLACE FUNCTION forum_lineage(forum_slug citext)
+    RETURNS TABLE
+            (
+                slug  citext,
+                depth int
+            )
+AS
+$$
+WITH RECURSIVE lineage AS (
+    SELECT f.slug, f.parent, 0 AS depth
+    FROM forums f
+    WHERE f.slug = forum_slug
+    UNION ALL
+    SELECT f.slug, f.parent, l.depth + 1
+    FROM forums f
+             JOIN lineage l ON f.slug = l.parent
+)
+SELECT lineage.slug, lineage.depth
+FROM lineage;
+$$ LANGUAGE sql STABLE;
+
 CREATE OR REPLACE FUNCTION threads_inc() RETURNS trigger AS
 $$
 BEGIN
     UPDATE forums
     SET threads = threads + 1
-    WHERE slug = NEW.forum;
+    WHERE slug IN (SELECT l.slug FROM forum_lineage(NEW.forum) l);
 
     RETURN NEW;
 END;
@@ -243,3 +429,237 @@ CREATE TRIGGER threads_inc
     ON threads
     FOR EACH ROW
 EXECUTE PROCEDURE threads_inc();
+
+CREATE OR REPLACE FUNCTION user_stats_ins() RETURNS trigger AS
+$$
+BEGIN
+    INSERT INTO user_stats(user_id)
+    VALUES (NEW.id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_stats_ins
+    AFTER INSERT
+    ON users
+    FOR EACH ROW
+EXECUTE PROCEDURE user_stats_ins();
+
+-- Shared by posts and threads, TG_TABLE_NAME picks the counter
+CREATE OR REPLACE FUNCTION user_stats_authored() RETURNS trigger AS
+$$
+DECLARE
+    value      int;
+    var_author citext;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        value := 1;
+        var_author := NEW.author;
+    ELSE
+        value := -1;
+        var_author := OLD.author;
+    END IF;
+
+    IF TG_TABLE_NAME = 'posts' THEN
+        UPDATE user_stats
+        SET posts = posts + value
+        WHERE user_id = (SELECT id FROM users WHERE nickname = var_author);
+    ELSE
+        UPDATE user_stats
+        SET threads = threads + value
+        WHERE user_id = (SELECT id FROM users WHERE nickname = var_author);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_stats_posts
+    AFTER INSERT OR DELETE
+    ON posts
+    FOR EACH ROW
+EXECUTE PROCEDURE user_stats_authored();
+
+CREATE TRIGGER user_stats_threads
+    AFTER INSERT OR DELETE
+    ON threads
+    FOR EACH ROW
+EXECUTE PROCEDURE user_stats_authored();
+
+-- Only participation counts, explicit membership alone doesn't
+CREATE OR REPLACE FUNCTION user_stats_forums() RETURNS trigger AS
+$$
+DECLARE
+    value int := 0;
+BEGIN
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.participant THEN
+        value := value + 1;
+    END IF;
+    IF TG_OP IN ('DELETE', 'UPDATE') AND OLD.participant THEN
+        value := value - 1;
+    END IF;
+
+    IF value <> 0 THEN
+        UPDATE user_stats
+        SET forums = forums + value
+        WHERE user_id = (SELECT id FROM users WHERE nickname = coalesce(NEW.nickname, OLD.nickname));
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_stats_forums
+    AFTER INSERT OR UPDATE OF participant OR DELETE
+    ON user_forum
+    FOR EACH ROW
+EXECUTE PROCEDURE user_stats_forums();
+
+-- Shared by posts, threads and votes, TG_TABLE_NAME picks the counter
+CREATE OR REPLACE FUNCTION forum_activity_ins() RETURNS trigger AS
+$$
+DECLARE
+    var_forum    citext;
+    var_hour     timestamptz;
+    var_nickname citext;
+BEGIN
+    IF TG_TABLE_NAME = 'votes' THEN
+        SELECT forum INTO var_forum FROM threads WHERE id = NEW.thread_id;
+        SELECT nickname INTO var_nickname FROM users WHERE id = NEW.user_id;
+        var_hour := date_trunc('hour', NEW.created);
+    ELSE
+        var_forum := NEW.forum;
+        var_nickname := NEW.author;
+        var_hour := date_trunc('hour', coalesce(NEW.created, now()));
+    END IF;
+
+    INSERT INTO forum_activity(forum, hour, posts, threads, votes)
+    VALUES (var_forum, var_hour,
+            (TG_TABLE_NAME = 'posts')::int,
+            (TG_TABLE_NAME = 'threads')::int,
+            (TG_TABLE_NAME = 'votes')::int)
+    ON CONFLICT (forum, hour) DO UPDATE
+        SET posts   = forum_activity.posts + excluded.posts,
+            threads = forum_activity.threads + excluded.threads,
+            votes   = forum_activity.votes + excluded.votes;
+
+    INSERT INTO forum_activity_users(forum, hour, nickname)
+    VALUES (var_forum, var_hour, var_nickname)
+    ON CONFLICT DO NOTHING;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER forum_activity_posts
+    AFTER INSERT
+    ON posts
+    FOR EACH ROW
+EXECUTE PROCEDURE forum_activity_ins();
+
+CREATE TRIGGER forum_activity_threads
+    AFTER INSERT
+    ON threads
+    FOR EACH ROW
+EXECUTE PROCEDURE forum_activity_ins();
+
+CREATE TRIGGER forum_activity_votes
+    AFTER INSERT
+    ON votes
+    FOR EACH ROW
+EXECUTE PROCEDURE forum_activity_ins();
+
+-- Live posts, threads and votes of the forum within the given hours,
+-- the rollups are rebuilt from them when content is hidden or moved
+CREATE OR REPLACE FUNCTION forum_activity_events(var_forum citext, var_hours timestamptz[])
+    RETURNS TABLE
+            (
+                hour     timestamptz,
+                nickname citext,
+                posts    int,
+                threads  int,
+                votes    int
+            )
+AS
+$$
+SELECT date_trunc('hour', p.created), p.author, 1, 0, 0
+FROM posts p
+WHERE p.forum = var_forum
+  AND NOT p.deleted
+  AND date_trunc('hour', p.created) = ANY (var_hours)
+UNION ALL
+SELECT date_trunc('hour', t.created), t.author, 0, 1, 0
+FROM threads t
+WHERE t.forum = var_forum
+  AND t.deleted_at IS NULL
+  AND date_trunc('hour', t.created) = ANY (var_hours)
+UNION ALL
+SELECT date_trunc('hour', v.created), u.nickname, 0, 0, 1
+FROM votes v
+         JOIN threads t ON t.id = v.thread_id
+         JOIN users u ON u.id = v.user_id
+WHERE t.forum = var_forum
+  AND t.deleted_at IS NULL
+  AND date_trunc('hour', v.created) = ANY (var_hours)
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION forum_activity_refresh(var_forum citext, var_hours timestamptz[]) RETURNS void AS
+$$
+BEGIN
+    DELETE FROM forum_activity WHERE forum = var_forum AND hour = ANY (var_hours);
+    DELETE FROM forum_activity_users WHERE forum = var_forum AND hour = ANY (var_hours);
+
+    INSERT INTO forum_activity(forum, hour, posts, threads, votes)
+    SELECT var_forum, e.hour, sum(e.posts), sum(e.threads), sum(e.votes)
+    FROM forum_activity_events(var_forum, var_hours) e
+    GROUP BY e.hour;
+
+    INSERT INTO forum_activity_users(forum, hour, nickname)
+    SELECT DISTINCT var_forum, e.hour, e.nickname
+    FROM forum_activity_events(var_forum, var_hours) e;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Hours the thread, its posts and its votes fall into
+CREATE OR REPLACE FUNCTION thread_activity_hours(var_thread int) RETURNS timestamptz[] AS
+$$
+SELECT coalesce(array_agg(DISTINCT h.hour), '{}')
+FROM (SELECT date_trunc('hour', created) AS hour FROM threads WHERE id = var_thread
+      UNION
+      SELECT date_trunc('hour', created) FROM posts WHERE thread = var_thread
+      UNION
+      SELECT date_trunc('hour', created) FROM votes WHERE thread_id = var_thread) h
+$$ LANGUAGE sql STABLE;
+
+-- Soft deletion takes threads with their posts and votes off the authors'
+-- stats (sign = -1), restoring puts them back (sign = 1). Hard deleting
+-- a soft deleted thread has to put them back first, the delete triggers
+-- take them off again.
+CREATE OR REPLACE FUNCTION user_stats_shift(thread_ids int[], sign int) RETURNS void AS
+$$
+BEGIN
+    UPDATE user_stats s
+    SET threads = s.threads + sign * c.threads,
+        karma   = s.karma + sign * c.karma
+    FROM (SELECT u.id, count(*) AS threads, coalesce(sum(t.votes), 0) AS karma
+          FROM threads t
+                   JOIN users u ON u.nickname = t.author
+          WHERE t.id = ANY (thread_ids)
+          GROUP BY u.id) c
+    WHERE s.user_id = c.id;
+
+    UPDATE user_stats s
+    SET posts = s.posts + sign * c.posts
+    FROM (SELECT u.id, count(*) AS posts
+          FROM posts p
+                   JOIN users u ON u.nickname = p.author
+          WHERE p.thread = ANY (thread_ids)
+          GROUP BY u.id) c
+    WHERE s.user_id = c.id;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Reserved account which takes over content of deleted users,
+-- keep in sync with internal/consts/user.go
+INSERT INTO users(nickname, fullname, about, email)
+VALUES ('deleted', 'Deleted user', '', 'deleted@localhost');
@@ -0,0 +1,70 @@
+package pgtest
+
+import (
+	"context"
+	"database/sql"
+	_ "github.com/lib/pq"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TEST_DATABASE_URL points the repository tests to a scratch database,
+// its tables are dropped and created again from scripts/init.sql
+const urlVariable = "TEST_DATABASE_URL"
+
+// packages are tested in parallel, the lock keeps them
+// from recreating the schema under each other
+const schemaLock = 20210101
+
+func Open(t *testing.T) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv(urlVariable)
+	if url == "" {
+		t.Skipf("%s is not set", urlVariable)
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	lock, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lock.ExecContext(context.Background(), `SELECT pg_advisory_lock($1)`, schemaLock); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = lock.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, schemaLock)
+		_ = lock.Close()
+	})
+
+	_, file, _, _ := runtime.Caller(0)
+	schema, err := ioutil.ReadFile(filepath.Join(filepath.Dir(file), "..", "..", "scripts", "init.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// runs setup statements without arguments, one after another
+func Exec(t *testing.T, db *sql.DB, statements ...string) {
+	t.Helper()
+
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+}
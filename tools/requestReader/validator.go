@@ -5,8 +5,43 @@ import (
 	"github.com/labstack/echo/v4"
 	. "github.com/technopark_database/internal/consts"
 	"github.com/technopark_database/internal/helpers/errors"
+	"reflect"
+	"regexp"
+	"strings"
 )
 
+var (
+	nicknameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+	slugRegexp     = regexp.MustCompile(`^(\d|\w|-|_)*(\w|-|_)(\d|\w|-|_)*$`)
+
+	// validations are registered once and shared by every reader
+	requestValidator = newValidator()
+)
+
+func newValidator() *validator.Validate {
+	validate := validator.New()
+
+	// offending fields are reported by their json, query or path names
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "query", "param"} {
+			name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+			if name != "" && name != "-" {
+				return name
+			}
+		}
+		return field.Name
+	})
+
+	_ = validate.RegisterValidation("nickname", func(fl validator.FieldLevel) bool {
+		return nicknameRegexp.MatchString(fl.Field().String())
+	})
+	_ = validate.RegisterValidation("slug", func(fl validator.FieldLevel) bool {
+		return slugRegexp.MatchString(fl.Field().String())
+	})
+
+	return validate
+}
+
 type RequestReader struct {
 	cntx      echo.Context
 	validator *validator.Validate
@@ -15,17 +50,54 @@ type RequestReader struct {
 func NewRequestReader(cntx echo.Context) *RequestReader {
 	return &RequestReader{
 		cntx:      cntx,
-		validator: validator.New(),
+		validator: requestValidator,
 	}
 }
 
 func (rr *RequestReader) Read(request interface{}) *errors.Error {
 	if err := rr.cntx.Bind(request); err != nil {
-		return errors.New(CodeInternalServerError, err)
+		return errors.New(CodeBadRequest, err)
+	}
+
+	return rr.Validate(request)
+}
+
+// Validate checks validate tags of a request struct
+// or of every struct in a request slice
+func (rr *RequestReader) Validate(request interface{}) *errors.Error {
+	return validateWith(rr.validator, request)
+}
+
+// Validate checks a value which doesn't come from a request body,
+// such as a record of an uploaded file
+func Validate(request interface{}) *errors.Error {
+	return validateWith(requestValidator, request)
+}
+
+func validateWith(validate *validator.Validate, request interface{}) *errors.Error {
+	var err error
+	if reflect.Indirect(reflect.ValueOf(request)).Kind() == reflect.Slice {
+		err = validate.Var(request, "dive")
+	} else {
+		err = validate.Struct(request)
+	}
+	if err == nil {
+		return nil
 	}
 
-	//if err := rr.validator.Struct(request); err != nil {
-	//	return errors.Get(CodeBadRequest)
-	//}
-	return nil
+	validationErrs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return errors.New(CodeBadRequest, err)
+	}
+
+	var fields []string
+	for _, fieldErr := range validationErrs {
+		namespace := fieldErr.Namespace()
+		// drop the name of the request struct itself
+		if dot := strings.Index(namespace, "."); dot != -1 && !strings.HasPrefix(namespace, "[") {
+			namespace = namespace[dot+1:]
+		}
+		fields = append(fields, namespace)
+	}
+	return errors.NewFieldsError(fields)
 }